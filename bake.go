@@ -7,12 +7,14 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/andrewkroh/bake/common"
+	"github.com/pkg/errors"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 var (
-	app   = kingpin.New("bake", "Utility for working with Beats projects")
-	debug = app.Flag("debug", "Enable debug logging").Short('d').Bool()
+	app        = kingpin.New("bake", "Utility for working with Beats projects")
+	debug      = app.Flag("debug", "Enable debug logging").Short('d').Bool()
+	configFile = app.Flag("config", "Project configuration file").PlaceHolder(projectConfigFile).String()
 
 	// TODO: The following commands are not implemented.
 
@@ -23,8 +25,6 @@ var (
 	testTypes    = test.Flag("tests", "Test types to execute. Options are unit (default), benchmark, integ, and system.").Default("unit").Enums("unit", "integ", "system", "benchmark")
 	testPackages = test.Arg("packages", "Packages to build. Defaults to building.").Default(".").String()
 
-	crosscompile = app.Command("crosscompile", "Cross-compile the beat without CGO")
-
 	docs = app.Command("docs", "Build the Elastic asciidoc book for the Beat")
 
 	ci = app.Command("ci", "Run all checks and tests.")
@@ -41,8 +41,23 @@ var (
 	// ProjectRootRel is the relative path to the root of the project based on
 	// the location of the .git directory.
 	ProjectRootRel string
+
+	// PassthroughArgs are the command line arguments following "--". They are
+	// not parsed by bake and are passed to the command that bake runs.
+	PassthroughArgs []string
+
+	// projectRootErr is set when bake is not run from within a Git clone. In
+	// that case only the commands in projectlessCommands can be used and the
+	// project root is the current directory.
+	projectRootErr error
 )
 
+// projectlessCommands are the commands that can be run outside of a project.
+var projectlessCommands = map[string]bool{
+	"new-beat": true,
+	vetCommand: true,
+}
+
 func init() {
 	var err error
 	CWD, err = os.Getwd()
@@ -52,7 +67,8 @@ func init() {
 
 	ProjectRootAbs, err = common.FindGitProjectRoot()
 	if err != nil {
-		app.Fatalf("%v: Are you running bake from within a Git clone?", err)
+		projectRootErr = err
+		ProjectRootAbs = CWD
 	}
 
 	ProjectRootRel, err = filepath.Rel(CWD, ProjectRootAbs)
@@ -66,6 +82,17 @@ func main() {
 	registerFmtCommand(app)
 	registerNoticeCommand(app)
 	registerDockerCommand(app)
+	registerHooksCommand(app)
+	registerUpdateCommand(app)
+	registerConfigCommand(app)
+	registerGenerateCommand(app)
+	registerNewBeatCommand(app)
+	registerCrosscompileCommand(app)
+	registerTestBinaryCommand(app)
+	registerPackageCommand(app)
+	registerVerifyBuildCommand(app)
+	registerCacheCommand(app)
+	registerVetCommand(app)
 
 	app.HelpFlag.Short('h')
 	app.DefaultEnvars()
@@ -77,12 +104,55 @@ func main() {
 		} else {
 			logrus.SetOutput(ioutil.Discard)
 		}
-		return nil
+
+		if projectRootErr != nil && ctx.SelectedCommand != nil && !projectlessCommands[ctx.SelectedCommand.FullCommand()] {
+			return errors.Errorf("%v: Are you running bake from within a Git clone?", projectRootErr)
+		}
+
+		path := filepath.Join(ProjectRootRel, projectConfigFile)
+		if *configFile != "" {
+			path = *configFile
+			if _, err := os.Stat(path); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		projectConfig, err = loadProjectConfig(path)
+		return err
 	})
 
-	_, err := app.Parse(os.Args[1:])
+	var args []string
+	args, PassthroughArgs = splitPassthroughArgs(app, os.Args[1:])
+
+	_, err := app.Parse(args)
 	if err != nil {
 		app.Errorf("%v\n", err)
 		os.Exit(1)
 	}
 }
+
+// passthroughCommands are the commands that run another command with the
+// arguments following "--".
+var passthroughCommands = map[string]bool{
+	"docker up": true,
+	vetCommand:  true,
+}
+
+// splitPassthroughArgs splits the arguments at the first "--" and returns the
+// arguments before and after it when the selected command is one of the
+// passthroughCommands. For other commands the arguments are returned as is so
+// that kingpin handles "--".
+func splitPassthroughArgs(app *kingpin.Application, args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg != "--" {
+			continue
+		}
+		ctx, err := app.ParseContext(args[:i])
+		if err != nil || ctx.SelectedCommand == nil || !passthroughCommands[ctx.SelectedCommand.FullCommand()] {
+			break
+		}
+		return args[:i], args[i+1:]
+	}
+	return args, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestMain(m *testing.M) {
+	// The vet check runs the test binary as bake's hidden vet command.
+	if len(os.Args) > 1 && os.Args[1] == vetCommand {
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+func TestSplitPassthroughArgs(t *testing.T) {
+	app := kingpin.New("bake", "")
+	registerDockerCommand(app)
+	registerCheckCommand(app)
+
+	args, passthrough := splitPassthroughArgs(app, []string{"docker", "redis", "--", "make", "--", "test"})
+	assert.Equal(t, []string{"docker", "redis"}, args)
+	assert.Equal(t, []string{"make", "--", "test"}, passthrough)
+
+	args, passthrough = splitPassthroughArgs(app, []string{"docker", "--", "make"})
+	assert.Equal(t, []string{"docker"}, args)
+	assert.Equal(t, []string{"make"}, passthrough)
+
+	args, passthrough = splitPassthroughArgs(app, []string{"check", "fmt"})
+	assert.Equal(t, []string{"check", "fmt"}, args)
+	assert.Nil(t, passthrough)
+
+	// Other commands leave "--" to kingpin.
+	args, passthrough = splitPassthroughArgs(app, []string{"check", "--", "fmt"})
+	assert.Equal(t, []string{"check", "--", "fmt"}, args)
+	assert.Nil(t, passthrough)
+}
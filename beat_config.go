@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+var configLog = logrus.WithField("package", "main").WithField("cmd", "config")
+
+func registerConfigCommand(app *kingpin.Application) {
+	cmd := &ConfigCommand{}
+	config := app.Command("config", "Assemble <beat>.yml and <beat>.reference.yml from the _meta config snippets.").Action(cmd.Run)
+	config.Flag("os", "Assemble the config for this GOOS (default: goos from the project config or linux)").PlaceHolder("GOOS").StringVar(&cmd.GOOS)
+	config.Flag("reference", "Assemble the reference config when writing to --output or --stdout").BoolVar(&cmd.Reference)
+	config.Flag("output", "Write a single config to this file instead of updating the project's config files").Short('o').PlaceHolder("FILE").StringVar(&cmd.Output)
+	config.Flag("stdout", "Write a single config to stdout instead of updating the project's config files").BoolVar(&cmd.Stdout)
+}
+
+type ConfigCommand struct {
+	GOOS      string
+	Reference bool
+	Output    string
+	Stdout    bool
+}
+
+func (c *ConfigCommand) Run(ctx *kingpin.ParseContext) error {
+	goos := c.GOOS
+	if goos == "" {
+		goos = projectConfig.Config.OS()
+	}
+
+	if c.Stdout && c.Output != "" {
+		return errors.New("--stdout and --output cannot be used together")
+	}
+	if c.Stdout || c.Output != "" {
+		data, err := assembleBeatConfig(c.Reference, goos)
+		if err != nil {
+			return err
+		}
+		if c.Stdout {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		return ioutil.WriteFile(c.Output, data, 0644)
+	}
+
+	for _, reference := range []bool{false, true} {
+		snippets, err := beatConfigSnippets(reference)
+		if err != nil {
+			return err
+		}
+		if len(snippets) == 0 {
+			configLog.WithField("reference", reference).Debug("no config snippets found")
+			continue
+		}
+
+		data, err := assembleBeatConfig(reference, goos)
+		if err != nil {
+			return err
+		}
+		path := beatConfigPath(reference)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return errors.Wrapf(err, "failed to write %v", path)
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+// beatConfigParams are the template variables available to config snippets.
+type beatConfigParams struct {
+	BeatName        string
+	BeatIndexPrefix string
+	GOOS            string
+	Reference       bool // True when assembling the reference config.
+}
+
+// beatConfigPath returns the path of the Beat's config file relative to the
+// current directory.
+func beatConfigPath(reference bool) string {
+	name := projectConfig.Beat.BeatName()
+	if reference {
+		return filepath.Join(ProjectRootRel, name+".reference.yml")
+	}
+	return filepath.Join(ProjectRootRel, name+".yml")
+}
+
+// beatConfigSnippets returns the snippets that make up the Beat's config in
+// the order that they are concatenated. The project's snippets come first
+// followed by the libbeat snippet.
+func beatConfigSnippets(reference bool) ([]string, error) {
+	cfg := projectConfig.Config
+	snippets, err := findYAMLFiles(ProjectRootRel, cfg.Patterns(reference))
+	if err != nil {
+		return nil, err
+	}
+	snippets, err = projectConfig.Files.Filter().Filter(snippets)
+	if err != nil {
+		return nil, err
+	}
+	if len(snippets) == 0 {
+		return nil, nil
+	}
+
+	if libbeat := cfg.LibbeatDir(); libbeat != "" {
+		name := "config.yml"
+		if reference {
+			name = "config.reference.yml"
+		}
+		path := filepath.Join(libbeat, "_meta", name)
+		if _, err := os.Stat(path); err == nil {
+			snippets = append(snippets, path)
+		}
+	}
+	return snippets, nil
+}
+
+// assembleBeatConfig concatenates the config snippets and renders them for
+// the given GOOS. Each snippet is a text/template that can use the fields of
+// beatConfigParams. The beatname and beat-index-prefix placeholders used by
+// libbeat are replaced too. An error is returned if the result is not valid
+// YAML.
+func assembleBeatConfig(reference bool, goos string) ([]byte, error) {
+	snippets, err := beatConfigSnippets(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	params := beatConfigParams{
+		BeatName:        projectConfig.Beat.BeatName(),
+		BeatIndexPrefix: projectConfig.Beat.Index(),
+		GOOS:            goos,
+		Reference:       reference,
+	}
+
+	buf := new(bytes.Buffer)
+	for i, path := range snippets {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		tmpl, err := template.New(path).Option("missingkey=error").Parse(string(data))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse config snippet %v", path)
+		}
+		rendered := new(bytes.Buffer)
+		if err := tmpl.Execute(rendered, params); err != nil {
+			return nil, errors.Wrapf(err, "failed to render config snippet %v", path)
+		}
+
+		if i > 0 && rendered.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		buf.Write(rendered.Bytes())
+		if rendered.Len() > 0 && !bytes.HasSuffix(rendered.Bytes(), []byte("\n")) {
+			buf.WriteString("\n")
+		}
+	}
+
+	out := strings.NewReplacer(
+		"beat-index-prefix", params.BeatIndexPrefix,
+		"beatname", params.BeatName,
+	).Replace(buf.String())
+
+	// The vendored yaml package does not report duplicate keys so they are
+	// checked for explicitly.
+	var config yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(out), &config); err != nil {
+		return nil, errors.Wrapf(err, "assembled config for %v is not valid YAML", goos)
+	}
+	keys := map[interface{}]bool{}
+	for _, item := range config {
+		if keys[item.Key] {
+			return nil, errors.Errorf("assembled config for %v is not valid YAML: key %v is defined more than once", goos, item.Key)
+		}
+		keys[item.Key] = true
+	}
+
+	return []byte(out), nil
+}
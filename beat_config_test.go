@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// useTestProject makes dir the project root and current directory and uses
+// config as the project config. The returned function restores the previous
+// state.
+func useTestProject(t *testing.T, dir string, config *ProjectConfig) func() {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	prevAbs, prevRel, prevConfig := ProjectRootAbs, ProjectRootRel, projectConfig
+	ProjectRootAbs, ProjectRootRel, projectConfig = dir, ".", config
+	return func() {
+		ProjectRootAbs, ProjectRootRel, projectConfig = prevAbs, prevRel, prevConfig
+		os.Chdir(cwd)
+	}
+}
+
+func TestAssembleBeatConfig(t *testing.T) {
+	dir := writeFieldsFiles(t, map[string]string{
+		"_meta/beat.yml":           "testbeat.modules:\n",
+		"_meta/beat.reference.yml": "testbeat.modules:\n",
+		"module/system/_meta/config.yml": `- module: system
+  period: 10s
+{{- if eq .GOOS "windows" }}
+  metricsets: [cpu]
+{{- else }}
+  metricsets: [cpu, load]
+{{- end }}`,
+		"module/apache/_meta/config.yml":           "- module: apache\n  hosts: [\"localhost\"]\n",
+		"module/apache/_meta/config.reference.yml": "- module: apache\n  enabled: {{ .Reference }}\n",
+		"libbeat/_meta/config.yml":                 "output.elasticsearch:\n  index: \"beat-index-prefix-%{+yyyy.MM.dd}\"\n#logging.to_files: beatname\n",
+	})
+	defer os.RemoveAll(dir)
+
+	config := &ProjectConfig{
+		Beat: BeatConfig{Name: "testbeat", IndexPrefix: "tb"},
+		Config: SnippetConfig{
+			Short:   []string{"_meta/beat.yml", "module/system/_meta/config.yml", "module/*/_meta/config.yml"},
+			Libbeat: "libbeat",
+		},
+		Files: FilesConfig{IncludeGitIgnored: true},
+	}
+	defer useTestProject(t, dir, config)()
+
+	out, err := assembleBeatConfig(false, "linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `testbeat.modules:
+
+- module: system
+  period: 10s
+  metricsets: [cpu, load]
+
+- module: apache
+  hosts: ["localhost"]
+
+output.elasticsearch:
+  index: "tb-%{+yyyy.MM.dd}"
+#logging.to_files: testbeat
+`, string(out))
+
+	out, err = assembleBeatConfig(false, "windows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(out), "  metricsets: [cpu]\n")
+
+	out, err = assembleBeatConfig(true, "linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "testbeat.modules:\n\n- module: apache\n  enabled: true\n", string(out))
+}
+
+func TestAssembleBeatConfigInvalid(t *testing.T) {
+	dir := writeFieldsFiles(t, map[string]string{
+		"_meta/beat.yml":                 "testbeat.modules:\n- module: a\n",
+		"module/a/_meta/config.yml":      "testbeat.modules:\n- module: b\n",
+		"module/b/_meta/config.yml":      "{{ .NoSuchParam }}",
+		"module/c/_meta/config.yml.orig": "",
+	})
+	defer os.RemoveAll(dir)
+
+	config := &ProjectConfig{Files: FilesConfig{IncludeGitIgnored: true}}
+	defer useTestProject(t, dir, config)()
+
+	config.Config.Short = []string{"_meta/beat.yml", "module/a/_meta/config.yml"}
+	_, err := assembleBeatConfig(false, "linux")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "not valid YAML")
+	}
+
+	config.Config.Short = []string{"module/b/_meta/config.yml"}
+	_, err = assembleBeatConfig(false, "linux")
+	assert.Error(t, err)
+}
+
+func TestConfigCommandOutput(t *testing.T) {
+	dir := writeFieldsFiles(t, map[string]string{
+		"_meta/beat.yml":           "testbeat.modules:\n",
+		"_meta/beat.reference.yml": "testbeat.reference:\n",
+	})
+	defer os.RemoveAll(dir)
+	config := &ProjectConfig{
+		Beat:   BeatConfig{Name: "testbeat"},
+		Config: SnippetConfig{Libbeat: "libbeat"},
+		Files:  FilesConfig{IncludeGitIgnored: true},
+	}
+	defer useTestProject(t, dir, config)()
+
+	run := func(args ...string) (string, error) {
+		stdout := os.Stdout
+		defer func() { os.Stdout = stdout }()
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Stdout = w
+
+		app := kingpin.New("bake", "")
+		registerConfigCommand(app)
+		_, err = app.Parse(append([]string{"config"}, args...))
+		w.Close()
+		out, _ := ioutil.ReadAll(r)
+		return string(out), err
+	}
+
+	out, err := run("--stdout", "--reference")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "testbeat.reference:\n", out)
+	}
+
+	path := filepath.Join(dir, "out.yml")
+	out, err = run("-o", path)
+	if assert.NoError(t, err) {
+		assert.Empty(t, out)
+		data, _ := ioutil.ReadFile(path)
+		assert.Equal(t, "testbeat.modules:\n", string(data))
+	}
+
+	_, err = run("--stdout", "--output", path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/andrewkroh/bake/common"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var buildLog = logrus.WithField("package", "main").WithField("cmd", "crosscompile")
+
+func registerCrosscompileCommand(app *kingpin.Application) {
+	cmd := &CrosscompileCommand{}
+	crosscompile := app.Command("crosscompile", "Cross-compile the beat without CGO (or with CGO in Docker using --cgo)").Action(cmd.Run)
+	crosscompile.Flag("platform", "GOOS/GOARCH to build (default: build.platforms from the project config)").PlaceHolder("GOOS/GOARCH").StringsVar(&cmd.Platforms)
+	crosscompile.Flag("cgo", "Build with CGO enabled in the cross-compiler Docker image configured for each platform in build.cgo.images").BoolVar(&cmd.CGO)
+	crosscompile.Flag("no-cache", "Rebuild binaries that are in the build cache. A cached binary that was not built with --reproducible keeps the build time of its original build.").BoolVar(&cmd.NoCache)
+	crosscompile.Flag("reproducible", "Build reproducibly with -trimpath, no build ID, and the build time from SOURCE_DATE_EPOCH (default: the commit time)").BoolVar(&cmd.Reproducible)
+}
+
+type CrosscompileCommand struct {
+	Platforms    []string
+	CGO          bool
+	NoCache      bool
+	Reproducible bool
+}
+
+func (c *CrosscompileCommand) Run(ctx *kingpin.ParseContext) error {
+	platforms, err := parsePlatforms(c.Platforms)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := getBuildMetadata(c.Reproducible)
+	if err != nil {
+		return err
+	}
+	flags := buildFlags(metadata.ldflags(projectConfig.Build.Vars), c.Reproducible)
+
+	inputs, err := getBuildInputs(platforms, c.CGO)
+	if err != nil {
+		return err
+	}
+	// The build time of a non-reproducible build is not part of the cache
+	// key. Otherwise the key would change with every build.
+	keyMetadata := *metadata
+	if !c.Reproducible {
+		keyMetadata.BuildTime = time.Time{}
+	}
+	keyFlags := buildFlags(keyMetadata.ldflags(projectConfig.Build.Vars), c.Reproducible)
+
+	var cgo *cgoToolchain
+	if c.CGO {
+		if cgo, err = newCGOToolchain(""); err != nil {
+			return err
+		}
+	}
+
+	cache := newBuildCache(c.NoCache)
+	for _, p := range platforms {
+		path := binaryPath(p)
+		key := inputs.key(p, keyFlags)
+		if cgo != nil {
+			if key, err = cgo.key(p, key); err != nil {
+				return err
+			}
+		}
+		cached, err := cache.get(key, filepath.Base(path), path)
+		if err != nil {
+			return err
+		}
+		if !cached {
+			if cgo != nil {
+				err = cgo.build(p, path, flags)
+			} else {
+				err = crosscompile(p, path, flags)
+			}
+			if err != nil {
+				return err
+			}
+			if err := cache.put(key, path); err != nil {
+				return err
+			}
+		}
+		buildLog.WithField("platform", p).WithField("cached", cached).Info("built binary")
+		fmt.Println(path)
+	}
+	return nil
+}
+
+// platform is a GOOS/GOARCH pair.
+type platform struct {
+	GOOS   string
+	GOARCH string
+}
+
+func (p platform) String() string {
+	return p.GOOS + "/" + p.GOARCH
+}
+
+// parsePlatforms parses the GOOS/GOARCH pairs. If none are given then the
+// platforms from the project config are returned.
+func parsePlatforms(values []string) ([]platform, error) {
+	if len(values) == 0 {
+		values = projectConfig.Build.PlatformList()
+	}
+
+	var platforms []platform
+	for _, v := range values {
+		parts := strings.Split(v, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid platform %q (use GOOS/GOARCH)", v)
+		}
+		platforms = append(platforms, platform{GOOS: parts[0], GOARCH: parts[1]})
+	}
+	return platforms, nil
+}
+
+// binaryPath returns the path of the Beat's binary for the platform relative
+// to the current directory (e.g. build/bin/metricbeat-linux-amd64).
+func binaryPath(p platform) string {
+	name := projectConfig.Beat.BeatName() + "-" + p.GOOS + "-" + p.GOARCH
+	if p.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(projectConfig.Build.OutputDir(), name)
+}
+
+// buildFlags returns the go build flags. Reproducible builds trim the file
+// system paths from the binary and have an empty build ID so that the binary
+// only depends on the source and the metadata.
+func buildFlags(ldflags string, reproducible bool) []string {
+	if reproducible {
+		return []string{"-trimpath", "-ldflags", strings.TrimSpace(ldflags + " -buildid=")}
+	}
+	return []string{"-ldflags", ldflags}
+}
+
+// crosscompile builds the Beat for the platform with CGO disabled and writes
+// the binary to path. env contains additional environment variables for go
+// build.
+func crosscompile(p platform, path string, flags []string, env ...string) error {
+	out, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	buildLog.WithField("platform", p).WithField("flags", flags).Debug("building")
+	args := append(append([]string{"build"}, flags...), "-o", out, ".")
+	cmd := exec.Command("go", args...)
+	cmd.Dir = ProjectRootAbs
+	cmd.Env = append(append(os.Environ(), "CGO_ENABLED=0", "GOOS="+p.GOOS, "GOARCH="+p.GOARCH), env...)
+	if _, err := common.RunCommand(cmd); err != nil {
+		return errors.Wrapf(err, "failed to build %v", p)
+	}
+	return nil
+}
+
+// buildMetadata describes a build of the Beat. It is injected into the
+// binary with -ldflags -X.
+type buildMetadata struct {
+	Version   string
+	Commit    string
+	Dirty     bool
+	BuildTime time.Time
+}
+
+// getBuildMetadata returns the metadata of a build of the project at
+// ProjectRootAbs. The build time is now unless the build is reproducible.
+func getBuildMetadata(reproducible bool) (*buildMetadata, error) {
+	commit, dirty, err := common.GitCommit(ProjectRootAbs)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := projectVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &buildMetadata{
+		Version:   version,
+		Commit:    commit,
+		Dirty:     dirty,
+		BuildTime: time.Now().UTC().Truncate(time.Second),
+	}
+	if reproducible {
+		if m.BuildTime, err = sourceDateEpoch(); err != nil {
+			return nil, err
+		}
+	}
+	buildLog.WithField("version", m.Version).WithField("commit", m.Commit).WithField("dirty", m.Dirty).Info("build metadata")
+	return m, nil
+}
+
+// sourceDateEpoch returns the build time of reproducible builds. It is
+// SOURCE_DATE_EPOCH (see https://reproducible-builds.org/specs/source-date-epoch/)
+// if set and otherwise the commit time of HEAD.
+func sourceDateEpoch() (time.Time, error) {
+	if v := os.Getenv("SOURCE_DATE_EPOCH"); v != "" {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "invalid SOURCE_DATE_EPOCH")
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	return common.GitCommitTime(ProjectRootAbs)
+}
+
+// ldflags returns the -X flags that set the variables to the metadata.
+func (m *buildMetadata) ldflags(vars BuildVars) string {
+	var flags []string
+	add := func(name, value string) {
+		if name != "" && value != "" {
+			flags = append(flags, "-X "+name+"="+value)
+		}
+	}
+	add(vars.Version, m.Version)
+	add(vars.Commit, m.Commit)
+	add(vars.Dirty, strconv.FormatBool(m.Dirty))
+	add(vars.BuildTime, m.BuildTime.Format(time.RFC3339))
+	return strings.Join(flags, " ")
+}
+
+// projectVersion returns the version of the project from the configured
+// version file or else from the most recent git tag. It returns an empty
+// string if the version is unknown.
+func projectVersion() (string, error) {
+	if file := projectConfig.Build.VersionFile; file != "" {
+		return versionFromGoFile(projectPath(file, ""))
+	}
+
+	tag, err := common.GitTag(ProjectRootAbs)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(tag, "v"), nil
+}
+
+// versionFromGoFile returns the value of the first string constant or
+// variable in the Go file whose name contains "version".
+func versionFromGoFile(path string) (string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse version file")
+	}
+
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || (gen.Tok != token.CONST && gen.Tok != token.VAR) {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			value := spec.(*ast.ValueSpec)
+			for i, name := range value.Names {
+				if i >= len(value.Values) || !strings.Contains(strings.ToLower(name.Name), "version") {
+					continue
+				}
+				if lit, ok := value.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					return strconv.Unquote(lit.Value)
+				}
+			}
+		}
+	}
+	return "", errors.Errorf("no version constant found in %v", path)
+}
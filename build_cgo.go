@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/andrewkroh/bake/common"
+	"github.com/andrewkroh/bake/common/docker"
+	"github.com/pkg/errors"
+)
+
+// Paths inside the cross-compiler containers.
+const (
+	cgoGoPath  = "/go"
+	cgoGoCache = "/gocache"
+	cgoOutput  = "/out"
+)
+
+// cgoToolchain builds the Beat with CGO enabled by running go build in the
+// cross-compiler Docker image configured for each platform. The project root,
+// the src directories of the GOPATH, and the Go build cache are mounted into
+// the container.
+type cgoToolchain struct {
+	client  *docker.Client
+	workdir string            // Project root inside the container.
+	gopaths []string          // GOPATH entries on the host that have a src directory.
+	goCache string            // Go build cache on the host.
+	images  map[string]string // Image IDs by name.
+}
+
+// newCGOToolchain returns a cgoToolchain that uses the local Docker daemon.
+// goCache is the Go build cache mounted into the containers. If empty then
+// the host's GOCACHE is used.
+func newCGOToolchain(goCache string) (*cgoToolchain, error) {
+	client, err := docker.NewClient("")
+	if err == nil {
+		err = client.Ping()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "CGO builds require a Docker daemon")
+	}
+
+	out, err := common.RunCommand(exec.Command("go", "env", "GOPATH", "GOCACHE"))
+	if err != nil {
+		return nil, err
+	}
+	env := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(env) != 2 {
+		return nil, errors.Errorf("unexpected go env output: %q", out)
+	}
+	if goCache == "" {
+		goCache = env[1]
+	}
+	if err := os.MkdirAll(goCache, 0755); err != nil {
+		return nil, err
+	}
+
+	var gopaths []string
+	for _, gopath := range filepath.SplitList(env[0]) {
+		if info, err := os.Stat(filepath.Join(gopath, "src")); err == nil && info.IsDir() {
+			gopaths = append(gopaths, gopath)
+		}
+	}
+
+	return &cgoToolchain{
+		client:  client,
+		workdir: containerWorkdir(ProjectRootAbs, gopaths),
+		gopaths: gopaths,
+		goCache: goCache,
+		images:  map[string]string{},
+	}, nil
+}
+
+// containerGoPath returns the path in the containers of the i-th GOPATH
+// entry (/go, /go1, /go2, ...).
+func containerGoPath(i int) string {
+	if i == 0 {
+		return cgoGoPath
+	}
+	return cgoGoPath + strconv.Itoa(i)
+}
+
+// containerWorkdir returns the directory where the project root is mounted in
+// the containers. A project inside one of the GOPATHs keeps its import path
+// below the src directory of that GOPATH entry in the container so that it
+// can be built in GOPATH mode. Other projects are mounted at /src.
+func containerWorkdir(root string, gopaths []string) string {
+	for i, gopath := range gopaths {
+		rel, err := filepath.Rel(filepath.Join(gopath, "src"), root)
+		if err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return path.Join(containerGoPath(i), "src", filepath.ToSlash(rel))
+		}
+	}
+	return "/src"
+}
+
+// image returns the name of the platform's image.
+func (t *cgoToolchain) image(p platform) (string, error) {
+	name := projectConfig.Build.CGO.Images[p.String()]
+	if name == "" {
+		return "", errors.Errorf("no CGO cross-compiler image is configured for %v (set build.cgo.images)", p)
+	}
+	return name, nil
+}
+
+// imageID returns the ID of the platform's image. The image is pulled if it
+// does not exist locally.
+func (t *cgoToolchain) imageID(p platform) (string, error) {
+	name, err := t.image(p)
+	if err != nil {
+		return "", err
+	}
+	if id, found := t.images[name]; found {
+		return id, nil
+	}
+
+	id, err := t.client.ImageID(name)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		buildLog.WithField("image", name).Info("pulling image")
+		if err := t.client.ImagePull(name); err != nil {
+			return "", err
+		}
+		if id, err = t.client.ImageID(name); err != nil {
+			return "", err
+		}
+	}
+	t.images[name] = id
+	return id, nil
+}
+
+// key returns the cache key of a binary for the platform given the key of
+// the binary built without Docker.
+func (t *cgoToolchain) key(p platform, key string) (string, error) {
+	id, err := t.imageID(p)
+	if err != nil {
+		return "", err
+	}
+	parts := []string{key, "cgo", id}
+	return cacheKey(append(parts, projectConfig.Build.CGO.Env[p.String()]...)...), nil
+}
+
+// build builds the Beat for the platform with CGO enabled and writes the
+// binary to path.
+func (t *cgoToolchain) build(p platform, path string, flags []string) error {
+	image, err := t.image(p)
+	if err != nil {
+		return err
+	}
+	out, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+
+	opts := t.runOptions(p, image, out, flags)
+	buildLog.WithField("platform", p).WithField("image", image).WithField("flags", flags).Debug("building in docker")
+	if _, err := common.RunCommand(opts.Cmd()); err != nil {
+		return errors.Wrapf(err, "failed to build %v in %v", p, image)
+	}
+	return nil
+}
+
+// runOptions returns the container that builds the platform's binary at out.
+func (t *cgoToolchain) runOptions(p platform, image, out string, flags []string) docker.RunOptions {
+	volumes := map[string]string{
+		ProjectRootAbs:    t.workdir,
+		t.goCache:         cgoGoCache,
+		filepath.Dir(out): cgoOutput,
+	}
+	// The dependencies that are not vendored are read from the host's GOPATH.
+	gopaths := []string{cgoGoPath}
+	for i, gopath := range t.gopaths {
+		volumes[filepath.Join(gopath, "src")] = path.Join(containerGoPath(i), "src") + ":ro"
+		if i > 0 {
+			gopaths = append(gopaths, containerGoPath(i))
+		}
+	}
+
+	env := []string{
+		"GOOS=" + p.GOOS,
+		"GOARCH=" + p.GOARCH,
+		"CGO_ENABLED=1",
+		"GOPATH=" + strings.Join(gopaths, ":"),
+		"GOCACHE=" + cgoGoCache,
+		"HOME=/tmp",
+	}
+	for _, name := range buildEnvVars {
+		if value := os.Getenv(name); value != "" {
+			env = append(env, name+"="+value)
+		}
+	}
+	env = append(env, projectConfig.Build.CGO.Env[p.String()]...)
+
+	opts := docker.RunOptions{
+		Image:   image,
+		Workdir: t.workdir,
+		Volumes: volumes,
+		Env:     env,
+		Command: append(append([]string{"go", "build"}, flags...), "-o", path.Join(cgoOutput, filepath.Base(out)), "."),
+	}
+	// Run as the current user so that the binary and the build cache are
+	// owned by the user.
+	if uid := os.Getuid(); uid >= 0 {
+		opts.User = fmt.Sprintf("%d:%d", uid, os.Getgid())
+	}
+	return opts
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerWorkdir(t *testing.T) {
+	gopaths := []string{"/home/user/go", "/opt/go"}
+	assert.Equal(t, "/go/src/github.com/acme/countbeat", containerWorkdir("/home/user/go/src/github.com/acme/countbeat", gopaths))
+	assert.Equal(t, "/src", containerWorkdir("/home/user/countbeat", gopaths))
+	assert.Equal(t, "/src", containerWorkdir("/home/user/go/src", gopaths))
+	assert.Equal(t, "/src", containerWorkdir("/home/user/go/srcs/countbeat", gopaths))
+	assert.Equal(t, "/go1/src/github.com/acme/countbeat", containerWorkdir("/opt/go/src/github.com/acme/countbeat", gopaths))
+}
+
+func TestCGORunOptions(t *testing.T) {
+	dir := os.TempDir()
+	config := &ProjectConfig{
+		Build: BuildConfig{CGO: CGOConfig{
+			Images: map[string]string{"linux/arm64": "crossbuild:arm"},
+			Env:    map[string][]string{"linux/arm64": {"CC=aarch64-linux-gnu-gcc"}},
+		}},
+	}
+	defer useTestProject(t, dir, config)()
+
+	cgo := &cgoToolchain{workdir: "/src", gopaths: []string{"/home/user/go", "/opt/go"}, goCache: "/home/user/.cache/go-build"}
+	p := platform{"linux", "arm64"}
+	image, err := cgo.image(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "build", "bin", "testbeat-linux-arm64")
+	opts := cgo.runOptions(p, image, out, []string{"-trimpath"})
+
+	assert.Equal(t, "crossbuild:arm", opts.Image)
+	assert.Equal(t, "/src", opts.Workdir)
+	assert.Equal(t, map[string]string{
+		dir:                          "/src",
+		"/home/user/.cache/go-build": "/gocache",
+		filepath.Dir(out):            "/out",
+		"/home/user/go/src":          "/go/src:ro",
+		"/opt/go/src":                "/go1/src:ro",
+	}, opts.Volumes)
+	for _, env := range []string{"GOOS=linux", "GOARCH=arm64", "CGO_ENABLED=1", "GOPATH=/go:/go1", "GOCACHE=/gocache", "CC=aarch64-linux-gnu-gcc"} {
+		assert.Contains(t, opts.Env, env)
+	}
+	assert.Equal(t, []string{"go", "build", "-trimpath", "-o", "/out/testbeat-linux-arm64", "."}, opts.Command)
+
+	_, err = cgo.image(platform{"windows", "amd64"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePlatforms(t *testing.T) {
+	platforms, err := parsePlatforms([]string{"linux/amd64", "windows/386"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []platform{{"linux", "amd64"}, {"windows", "386"}}, platforms)
+
+	for _, invalid := range []string{"linux", "linux/", "/amd64", "linux/amd64/v2"} {
+		_, err := parsePlatforms([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestVersionFromGoFile(t *testing.T) {
+	dir := writeFieldsFiles(t, map[string]string{
+		"version.go": `package version
+
+import "fmt"
+
+var unrelated = "1.0"
+
+const defaultBeatVersion = "6.1.0-alpha1"
+
+var buildVersion = fmt.Sprint(defaultBeatVersion)
+`,
+		"empty.go": "package version\n\nconst name = \"beat\"\n",
+	})
+	defer os.RemoveAll(dir)
+
+	version, err := versionFromGoFile(filepath.Join(dir, "version.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "6.1.0-alpha1", version)
+
+	_, err = versionFromGoFile(filepath.Join(dir, "empty.go"))
+	assert.Error(t, err)
+}
+
+func TestBuildMetadataLDFlags(t *testing.T) {
+	m := &buildMetadata{
+		Version:   "6.0.0",
+		Commit:    "0123abcd",
+		Dirty:     true,
+		BuildTime: time.Date(2017, 10, 12, 8, 5, 34, 0, time.UTC),
+	}
+
+	assert.Equal(t, "", m.ldflags(BuildVars{}))
+	assert.Equal(t,
+		"-X github.com/elastic/beats/libbeat/version.commit=0123abcd "+
+			"-X main.dirty=true "+
+			"-X github.com/elastic/beats/libbeat/version.buildTime=2017-10-12T08:05:34Z",
+		m.ldflags(BuildVars{
+			Commit:    "github.com/elastic/beats/libbeat/version.commit",
+			Dirty:     "main.dirty",
+			BuildTime: "github.com/elastic/beats/libbeat/version.buildTime",
+		}))
+
+	// Unknown values are not set.
+	m.Version = ""
+	assert.Equal(t, "", m.ldflags(BuildVars{Version: "main.version"}))
+}
+
+func TestBuildFlags(t *testing.T) {
+	assert.Equal(t, []string{"-ldflags", "-X main.commit=abc"}, buildFlags("-X main.commit=abc", false))
+	assert.Equal(t, []string{"-trimpath", "-ldflags", "-X main.commit=abc -buildid="}, buildFlags("-X main.commit=abc", true))
+	assert.Equal(t, []string{"-trimpath", "-ldflags", "-buildid="}, buildFlags("", true))
+}
+
+func TestTestBinaryArgs(t *testing.T) {
+	flags := []string{"-ldflags", "-X main.commit=abc"}
+	assert.Equal(t, []string{"test", "-c", "-ldflags", "-X main.commit=abc", "-o", "/out/countbeat.test", "."},
+		testBinaryArgs(flags, "/out/countbeat.test", false))
+	assert.Equal(t, []string{"test", "-c", "-ldflags", "-X main.commit=abc", "-covermode=atomic", "-coverpkg=./...", "-o", "/out/countbeat.test", "."},
+		testBinaryArgs(flags, "/out/countbeat.test", true))
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	prev, set := os.LookupEnv("SOURCE_DATE_EPOCH")
+	defer func() {
+		if set {
+			os.Setenv("SOURCE_DATE_EPOCH", prev)
+		} else {
+			os.Unsetenv("SOURCE_DATE_EPOCH")
+		}
+	}()
+
+	os.Setenv("SOURCE_DATE_EPOCH", "1507795534")
+	epoch, err := sourceDateEpoch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, time.Date(2017, 10, 12, 8, 5, 34, 0, time.UTC), epoch)
+
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	_, err = sourceDateEpoch()
+	assert.Error(t, err)
+}
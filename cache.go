@@ -0,0 +1,343 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/andrewkroh/bake/common"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var cacheLog = logrus.WithField("package", "main").WithField("cmd", "cache")
+
+func registerCacheCommand(app *kingpin.Application) {
+	cmd := &CacheCommand{}
+	cache := app.Command("cache", "Manage the cache of binaries and packages.")
+
+	prune := cache.Command("prune", "Remove cache entries that have not been used recently.").Action(cmd.Prune)
+	prune.Flag("older-than", "Remove entries that have not been used for this long").Default("168h").DurationVar(&cmd.OlderThan)
+	prune.Flag("all", "Remove all entries").BoolVar(&cmd.All)
+}
+
+type CacheCommand struct {
+	OlderThan time.Duration
+	All       bool
+}
+
+// Prune removes the cache entries that are older than c.OlderThan.
+func (c *CacheCommand) Prune(ctx *kingpin.ParseContext) error {
+	cache := newBuildCache(false)
+	olderThan := c.OlderThan
+	if c.All {
+		olderThan = 0
+	}
+
+	removed, size, err := cache.prune(time.Now().Add(-olderThan))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("removed %d cache entries (%.1f MB)\n", removed, float64(size)/(1<<20))
+	return nil
+}
+
+// buildCache stores binaries and packages under a key that is derived from
+// all of their inputs. Each entry is a directory named by the key that
+// contains the artifact. The modification time of the entry is updated
+// whenever it is used.
+type buildCache struct {
+	Dir    string
+	NoRead bool // Always rebuild but still store the results.
+}
+
+func newBuildCache(noRead bool) *buildCache {
+	return &buildCache{Dir: projectConfig.Build.CacheDir(), NoRead: noRead}
+}
+
+// get copies the artifact with the given name from the cache entry to dst.
+// It returns false if the entry does not exist.
+func (c *buildCache) get(key, name, dst string) (bool, error) {
+	if c.NoRead {
+		return false, nil
+	}
+
+	entry := filepath.Join(c.Dir, key)
+	src := filepath.Join(entry, name)
+	if _, err := os.Stat(src); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		return false, errors.Wrap(err, "failed to copy from the cache")
+	}
+	now := time.Now()
+	os.Chtimes(entry, now, now)
+	cacheLog.WithField("key", key).WithField("file", dst).Debug("cache hit")
+	return true, nil
+}
+
+// put stores a copy of the file in the cache entry.
+func (c *buildCache) put(key, src string) error {
+	entry := filepath.Join(c.Dir, key)
+	if err := os.MkdirAll(entry, 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that an interrupted copy is never
+	// used.
+	dst := filepath.Join(entry, filepath.Base(src))
+	tmp := dst + ".tmp"
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "failed to copy to the cache")
+	}
+	return os.Rename(tmp, dst)
+}
+
+// prune removes the entries that were last used before the given time. It
+// returns the number of entries removed and their size in bytes.
+func (c *buildCache) prune(before time.Time) (int, int64, error) {
+	entries, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+
+	var removed int
+	var size int64
+	for _, entry := range entries {
+		if !entry.IsDir() || !entry.ModTime().Before(before) {
+			continue
+		}
+
+		path := filepath.Join(c.Dir, entry.Name())
+		files, _ := ioutil.ReadDir(path)
+		for _, f := range files {
+			size += f.Size()
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return removed, size, err
+		}
+		cacheLog.WithField("entry", path).Debug("removed cache entry")
+		removed++
+	}
+	return removed, size, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// cacheKey returns the hex encoded SHA-256 of the parts.
+func cacheKey(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		io.WriteString(h, p)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// buildEnvVars are the environment variables that change the output of go
+// build in addition to GOOS, GOARCH, and CGO_ENABLED.
+var buildEnvVars = []string{"GO111MODULE", "GOFLAGS", "GOEXPERIMENT", "GO386", "GOAMD64", "GOARM", "GOARM64", "GOMIPS", "GOMIPS64", "GOPPC64", "GOWASM"}
+
+// buildInputs describes the inputs of go build that are shared by all
+// platforms. It is used to compute the cache keys of binaries.
+type buildInputs struct {
+	GoVersion    string
+	Sources      string // Digest of the project's Go files including vendor.
+	Dependencies string // Digest of the dependencies outside of the project.
+	Env          []string
+}
+
+// getBuildInputs returns the inputs of the project's builds for the
+// platforms.
+func getBuildInputs(platforms []platform, cgo bool) (*buildInputs, error) {
+	version, err := common.RunCommand(exec.Command("go", "version"))
+	if err != nil {
+		return nil, err
+	}
+
+	sources, err := goSourcesDigest(ProjectRootAbs, []string{
+		projectConfig.Build.OutputDir(),
+		projectConfig.Build.CacheDir(),
+		projectConfig.Package.OutputDir(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dependencies, err := goDependenciesDigest(ProjectRootAbs, platforms, cgo)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := &buildInputs{
+		GoVersion:    strings.TrimSpace(string(version)),
+		Sources:      sources,
+		Dependencies: dependencies,
+	}
+	for _, name := range buildEnvVars {
+		inputs.Env = append(inputs.Env, name+"="+os.Getenv(name))
+	}
+	return inputs, nil
+}
+
+// key returns the cache key of a binary for the platform built with flags.
+func (in *buildInputs) key(p platform, flags []string) string {
+	parts := []string{"crosscompile", in.GoVersion, in.Sources, in.Dependencies, p.String(), strings.Join(flags, " ")}
+	return cacheKey(append(parts, in.Env...)...)
+}
+
+// goSourceExtensions are the extensions of the files that go build reads.
+var goSourceExtensions = map[string]bool{
+	".go": true, ".s": true, ".c": true, ".cc": true, ".cpp": true, ".h": true, ".syso": true,
+}
+
+// goSourcesDigest returns a digest of the paths and contents of the files
+// under root that are read by go build: Go, assembly, and C sources
+// (excluding tests) plus go.mod and go.sum. Vendored files are included.
+// Hidden and testdata directories and the excluded directories are skipped.
+func goSourcesDigest(root string, exclude []string) (string, error) {
+	skip := map[string]bool{}
+	for _, dir := range exclude {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return "", err
+		}
+		skip[abs] = true
+	}
+
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || skip[path]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		if goSourceExtensions[filepath.Ext(name)] || name == "go.mod" || name == "go.sum" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, path := range files {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return "", err
+		}
+		sum, err := common.Sha256Sum(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %s\n", sum, filepath.ToSlash(rel))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// goDependenciesDigest returns a digest of the Go sources of the non-standard
+// packages that the package in root depends on and that are outside of root
+// (e.g. in the GOPATH). The dependencies of all platforms are included.
+func goDependenciesDigest(root string, platforms []platform, cgo bool) (string, error) {
+	cgoEnabled := "CGO_ENABLED=0"
+	if cgo {
+		cgoEnabled = "CGO_ENABLED=1"
+	}
+
+	dirs := map[string]string{}
+	for _, p := range platforms {
+		cmd := exec.Command("go", "list", "-e", "-deps", "-f", "{{if not .Standard}}{{.ImportPath}} {{.Dir}}{{end}}", ".")
+		cmd.Dir = root
+		cmd.Env = append(os.Environ(), cgoEnabled, "GOOS="+p.GOOS, "GOARCH="+p.GOARCH)
+		out, err := common.RunCommand(cmd)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to list the dependencies for %v", p)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			parts := strings.SplitN(line, " ", 2)
+			if len(parts) != 2 || parts[1] == "" {
+				continue
+			}
+			if rel, err := filepath.Rel(root, parts[1]); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			dirs[parts[0]] = parts[1]
+		}
+	}
+
+	importPaths := make([]string, 0, len(dirs))
+	for importPath := range dirs {
+		importPaths = append(importPaths, importPath)
+	}
+	sort.Strings(importPaths)
+
+	h := sha256.New()
+	for _, importPath := range importPaths {
+		files, err := ioutil.ReadDir(dirs[importPath])
+		if err != nil {
+			return "", err
+		}
+		for _, f := range files {
+			name := f.Name()
+			if !f.Mode().IsRegular() || strings.HasSuffix(name, "_test.go") || !goSourceExtensions[filepath.Ext(name)] {
+				continue
+			}
+			sum, err := common.Sha256Sum(filepath.Join(dirs[importPath], name))
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "%s %s/%s\n", sum, importPath, name)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheKey(t *testing.T) {
+	assert.Equal(t, cacheKey("a", "b"), cacheKey("a", "b"))
+	assert.NotEqual(t, cacheKey("a", "b"), cacheKey("ab"))
+	assert.NotEqual(t, cacheKey("a", "b"), cacheKey("b", "a"))
+}
+
+func TestBuildCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bake-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "beat")
+	if err := ioutil.WriteFile(src, []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := &buildCache{Dir: filepath.Join(dir, "cache")}
+	dst := filepath.Join(dir, "out", "beat")
+	cached, err := cache.get("key", "beat", dst)
+	assert.NoError(t, err)
+	assert.False(t, cached)
+
+	if err := cache.put("key", src); err != nil {
+		t.Fatal(err)
+	}
+	cached, err = cache.get("key", "beat", dst)
+	assert.NoError(t, err)
+	assert.True(t, cached)
+	data, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "binary", string(data))
+	if info, err := os.Stat(dst); assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	}
+
+	// The entry is never read when NoRead is set.
+	cached, err = (&buildCache{Dir: cache.Dir, NoRead: true}).get("key", "beat", dst)
+	assert.NoError(t, err)
+	assert.False(t, cached)
+
+	// Recently used entries are kept.
+	removed, _, err := cache.prune(time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	removed, size, err := cache.prune(time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.EqualValues(t, len("binary"), size)
+	_, err = os.Stat(filepath.Join(cache.Dir, "key"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestGoSourcesDigest(t *testing.T) {
+	dir := writeFieldsFiles(t, map[string]string{
+		"main.go":               "package main\n",
+		"main_test.go":          "package main\n",
+		"vendor/lib/lib.go":     "package lib\n",
+		"build/bin/beat":        "binary",
+		"testdata/data.go":      "package data\n",
+		"README.md":             "readme\n",
+		".git/hooks/pre-commit": "#!/bin/sh\n",
+	})
+	defer os.RemoveAll(dir)
+	exclude := []string{filepath.Join(dir, "build")}
+
+	digest := func() string {
+		d, err := goSourcesDigest(dir, exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	initial := digest()
+	for _, name := range []string{"main_test.go", "build/bin/beat", "testdata/data.go", "README.md"} {
+		write(name, "changed")
+		assert.Equal(t, initial, digest(), name)
+	}
+
+	write("vendor/lib/lib.go", "package lib\n\nvar x = 1\n")
+	vendored := digest()
+	assert.NotEqual(t, initial, vendored)
+
+	write("main.go", "package main\n\nfunc main() {}\n")
+	assert.NotEqual(t, vendored, digest())
+}
+
+func TestGoDependenciesDigest(t *testing.T) {
+	gopath := writeFieldsFiles(t, map[string]string{
+		"src/example.com/countbeat/main.go": "package main\n\nimport _ \"example.com/lib\"\n\nfunc main() {}\n",
+		"src/example.com/lib/lib.go":        "package lib\n",
+		"src/example.com/lib/lib_test.go":   "package lib\n",
+		"src/example.com/other/other.go":    "package other\n",
+	})
+	defer os.RemoveAll(gopath)
+	for name, value := range map[string]string{"GOPATH": gopath, "GO111MODULE": "off", "GOFLAGS": ""} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+	root := filepath.Join(gopath, "src/example.com/countbeat")
+	platforms := []platform{{GOOS: "linux", GOARCH: "amd64"}}
+
+	digest := func() string {
+		d, err := goDependenciesDigest(root, platforms, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(gopath, "src/example.com", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	initial := digest()
+	for name, content := range map[string]string{
+		"countbeat/main.go": "package main\n\nimport _ \"example.com/lib\"\n\nvar x = 1\n\nfunc main() {}\n",
+		"lib/lib_test.go":   "package lib\n\nvar y = 1\n",
+		"other/other.go":    "package other\n\nvar x = 1\n",
+	} {
+		write(name, content)
+		assert.Equal(t, initial, digest(), name)
+	}
+
+	write("lib/lib.go", "package lib\n\nvar x = 1\n")
+	assert.NotEqual(t, initial, digest())
+}
@@ -2,12 +2,16 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
+	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/andrewkroh/bake/common"
@@ -16,68 +20,188 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
+var checkLog = logrus.WithField("package", "main").WithField("cmd", "check")
+
+// Check is a project check that can be run by the check command. Checks
+// register themselves with registerCheck from an init function.
+type Check interface {
+	// Name returns the unique name used to select the check.
+	Name() string
+
+	// Description returns a one line description of the check.
+	Description() string
+
+	// Run executes the check and returns its findings. An error is returned
+	// only if the check could not be run.
+	Run(opts CheckOptions) ([]Finding, error)
+}
+
+// CheckOptions contains the options that apply to all checks.
+type CheckOptions struct {
+	// Since is a git ref. When set, checks only examine files and packages
+	// that changed since the ref.
+	Since string
+}
+
+// GoFiles returns the non-vendor Go files to be checked. Files are selected
+// by the project's file filter (see FilesConfig).
+func (o CheckOptions) GoFiles() ([]string, error) {
+	var files []string
+	var err error
+	if o.Since != "" {
+		files, err = common.ChangedGoFiles(o.Since)
+	} else {
+		files, err = common.GoFiles()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return projectConfig.Files.Filter().Filter(files)
+}
+
+// GoPackages returns the non-vendor Go packages containing the files
+// returned by GoFiles.
+func (o CheckOptions) GoPackages() ([]string, error) {
+	files, err := o.GoFiles()
+	if err != nil {
+		return nil, err
+	}
+	return common.GoPackagesForFiles(files)
+}
+
+// Severity is the severity level of a finding.
+type Severity string
+
+// Severity levels. Only findings with SeverityError cause a check to fail.
 const (
-	format = "fmt"
-	vet    = "vet"
-	notice = "notice"
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
 )
 
-var allChecks = []string{format, vet, notice}
+// Finding is a problem reported by a check.
+type Finding struct {
+	Check    string   `json:"check"`          // Name of the check that reported the finding.
+	File     string   `json:"file,omitempty"` // File associated with the finding (optional).
+	Line     int      `json:"line,omitempty"` // 1-based line number (optional).
+	Column   int      `json:"column,omitempty"`
+	Message  string   `json:"message"`
+	Severity Severity `json:"severity"`
+}
 
-var checkLog = logrus.WithField("package", "main").WithField("cmd", "check")
+// Position returns the file:line:column of the finding. The line and column
+// are omitted when they are unknown.
+func (f Finding) Position() string {
+	pos := f.File
+	if f.Line > 0 {
+		pos += ":" + strconv.Itoa(f.Line)
+		if f.Column > 0 {
+			pos += ":" + strconv.Itoa(f.Column)
+		}
+	}
+	return pos
+}
+
+func (f Finding) String() string {
+	if f.File == "" {
+		return fmt.Sprintf("%s (%s)", f.Message, f.Check)
+	}
+	return fmt.Sprintf("%s: %s (%s)", f.Position(), f.Message, f.Check)
+}
+
+// goPositionRegex matches the position prefix of messages produced by the Go
+// tools (e.g. "main.go:12:3: message").
+var goPositionRegex = regexp.MustCompile(`^(.+?\.go):(\d+)(?::(\d+))?: (.*)$`)
+
+// parseGoPositionFinding creates a finding from a message that may begin with
+// a Go file position.
+func parseGoPositionFinding(check, msg string) Finding {
+	f := Finding{Check: check, Message: msg, Severity: SeverityError}
+	if m := goPositionRegex.FindStringSubmatch(msg); m != nil {
+		f.File = m[1]
+		f.Line, _ = strconv.Atoi(m[2])
+		f.Column, _ = strconv.Atoi(m[3])
+		f.Message = m[4]
+	}
+	return f
+}
+
+// checks contains all registered checks by name.
+var checks = map[string]Check{}
+
+// registerCheck adds a check to the registry. It panics if a check with the
+// same name is already registered.
+func registerCheck(c Check) {
+	if _, found := checks[c.Name()]; found {
+		panic(errors.Errorf("check %v is already registered", c.Name()))
+	}
+	checks[c.Name()] = c
+}
+
+// checkNames returns the sorted names of all registered checks.
+func checkNames() []string {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
 func registerCheckCommand(app *kingpin.Application) {
 	cmd := &CheckCommand{}
-	check := app.Command("check", "Run checks on the project. The options are fmt, vet, and notice. By default all checks are run.").Action(cmd.Run)
-	check.Arg("checks", "checks to run").EnumsVar(&cmd.Checks, allChecks...)
+	check := app.Command("check", "Run checks on the project. By default all checks are run "+
+		"except those disabled in the project config. Use --list to see the available checks.").Action(cmd.Run)
+	check.Flag("list", "List the available checks").BoolVar(&cmd.List)
+	check.Flag("jobs", "Number of checks to run concurrently").Short('j').Default(strconv.Itoa(runtime.NumCPU())).IntVar(&cmd.Jobs)
+	check.Flag("since", "Only check Go files and packages changed since the given git ref (including uncommitted changes)").PlaceHolder("REF").StringVar(&cmd.Since)
+	check.Flag("format", "Output format for findings: "+strings.Join(reportFormatNames(), ", ")).Default("text").EnumVar(&cmd.Format, reportFormatNames()...)
+	check.Arg("checks", "checks to run").EnumsVar(&cmd.Checks, checkNames()...)
 }
 
 type CheckCommand struct {
 	Checks []string
+	List   bool
+	Jobs   int
+	Format string
+	Since  string
 }
 
 func (c *CheckCommand) Run(ctx *kingpin.ParseContext) error {
 	checkLog.WithField("cmd", c).Debug("Running checks")
 
-	checks := c.Checks
-	if len(c.Checks) == 0 {
-		checks = allChecks
+	if c.List {
+		return listChecks()
+	}
+
+	names, err := selectChecks(c.Checks, projectConfig.Check)
+	if err != nil {
+		return err
+	}
+
+	results := runChecks(names, CheckOptions{Since: c.Since}, c.Jobs)
+
+	if err := reportFormats[c.Format](os.Stdout, results); err != nil {
+		return errors.Wrap(err, "failed to write check report")
+	}
+
+	// The summary goes to stderr for machine readable formats so that
+	// stdout only contains the report.
+	summaryOut := os.Stdout
+	if c.Format != "text" {
+		summaryOut = os.Stderr
 	}
+	printCheckSummary(summaryOut, results)
 
 	var errs multierror.Errors
-	for _, c := range checks {
-		checkLog.Debugf("Running %v check", c)
-
-		switch c {
-		case format:
-			files, err := checkFormatting()
-			if err != nil {
-				errs = append(errs, err)
-				continue
-			}
-			for _, f := range files {
-				fmt.Println(f)
-			}
-			if len(files) > 0 {
-				errs = append(errs, errors.New("some files need to be formatted with gofmt -s"))
-			}
-		case vet:
-			problems, err := checkVet()
-			if err != nil {
-				errs = append(errs, err)
-				continue
-			}
-			for _, f := range problems {
-				fmt.Println(f)
-			}
-			if len(problems) > 0 {
-				errs = append(errs, errors.New("some files have go vet errors"))
-			}
-		case notice:
-			if err := checkNotice(); err != nil {
-				errs = append(errs, err)
-				continue
-			}
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, errors.Wrapf(r.Err, "%v check failed to run", r.Name))
+			continue
+		}
+
+		if !r.Passed() {
+			errs = append(errs, errors.Errorf("%v check reported %d problem(s)", r.Name, len(r.Findings)))
 		}
 	}
 
@@ -88,73 +212,138 @@ func (c *CheckCommand) Run(ctx *kingpin.ParseContext) error {
 	return errs.Err()
 }
 
-func checkFormatting() ([]string, error) {
-	files, err := common.GoFiles()
-	if err != nil {
-		return nil, err
-	}
+// checkResult is the outcome of running a single check.
+type checkResult struct {
+	Name     string
+	Findings []Finding
+	Err      error
+	Duration time.Duration
+}
 
-	args := make([]string, 0, len(files)+2)
-	args = append(args, "-s", "-l")
-	args = append(args, files...)
+// Passed returns true if the check ran and reported no error findings.
+func (r checkResult) Passed() bool {
+	if r.Err != nil {
+		return false
+	}
+	for _, f := range r.Findings {
+		if f.Severity == SeverityError {
+			return false
+		}
+	}
+	return true
+}
 
-	out, err := common.RunCommand(exec.Command("gofmt", args...))
-	if err != nil {
-		return nil, err
+// runChecks runs the named checks with at most jobs running concurrently.
+// The results are returned in the same order as names.
+func runChecks(names []string, opts CheckOptions, jobs int) []checkResult {
+	if jobs < 1 {
+		jobs = 1
 	}
 
-	return strings.Fields(string(out)), nil
-}
+	results := make([]checkResult, len(names))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
 
-func checkVet() ([]string, error) {
-	packages, err := common.GoPackages()
-	if err != nil {
-		return nil, err
+			checkLog.Debugf("Running %v check", name)
+			start := time.Now()
+			findings, err := checks[name].Run(opts)
+			for j := range findings {
+				if findings[j].Check == "" {
+					findings[j].Check = name
+				}
+				if findings[j].Severity == "" {
+					findings[j].Severity = SeverityError
+				}
+			}
+			results[i] = checkResult{
+				Name:     name,
+				Findings: findings,
+				Err:      err,
+				Duration: time.Since(start),
+			}
+			checkLog.WithField("duration", results[i].Duration).Debugf("Completed %v check", name)
+		}(i, name)
 	}
+	wg.Wait()
 
-	args := make([]string, 0, len(packages)+1)
-	args = append(args, "vet")
-	args = append(args, packages...)
+	return results
+}
 
-	out, err := common.RunCommand(exec.Command("go", args...))
-	if err != nil {
-		return nil, err
+// printCheckSummary prints a table showing the result and duration of each
+// check.
+func printCheckSummary(out io.Writer, results []checkResult) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "CHECK\tRESULT\tFINDINGS\tTIME")
+	for _, r := range results {
+		result := "pass"
+		switch {
+		case r.Err != nil:
+			result = "error"
+		case !r.Passed():
+			result = "fail"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%v\n", r.Name, result, len(r.Findings), r.Duration.Round(time.Millisecond))
 	}
+	w.Flush()
+}
 
-	if len(out) == 0 {
-		return nil, nil
+// selectChecks returns the names of the checks to run. Checks given on the
+// command line are always run. Otherwise the enabled checks from the config
+// (or all checks) are run, less those that are disabled.
+func selectChecks(requested []string, config CheckConfig) ([]string, error) {
+	for _, name := range append(config.Enabled, config.Disabled...) {
+		if _, found := checks[name]; !found {
+			return nil, errors.Errorf("unknown check %v in project config", name)
+		}
 	}
 
-	return strings.Split(string(out), "\n"), nil
-}
+	if len(requested) > 0 {
+		return requested, nil
+	}
 
-func checkNotice() error {
-	file := filepath.Join(os.TempDir(), "NOTICE-"+strconv.Itoa(rand.Int()))
-	defer os.Remove(file)
+	candidates := config.Enabled
+	if len(candidates) == 0 {
+		candidates = checkNames()
+	}
 
-	cmd := getNoticeCommandDefaults()
-	defaultOutput := cmd.Output
-	cmd.Output = file
-	if err := generateNotice(cmd); err != nil {
-		return err
+	disabled := map[string]bool{}
+	for _, name := range config.Disabled {
+		disabled[name] = true
 	}
 
-	existingSum, err := common.Sha256Sum(defaultOutput)
-	if err != nil {
-		return errors.Wrap(err, "failed reading existing NOTICE file")
+	var selected []string
+	for _, name := range candidates {
+		if !disabled[name] {
+			selected = append(selected, name)
+		}
 	}
+	return selected, nil
+}
 
-	newSum, err := common.Sha256Sum(file)
+func listChecks() error {
+	selected, err := selectChecks(nil, projectConfig.Check)
 	if err != nil {
-		return errors.Wrap(err, "failed reading new NOTICE file")
+		return err
+	}
+	enabled := map[string]bool{}
+	for _, name := range selected {
+		enabled[name] = true
 	}
-	checkLog.WithFields(logrus.Fields{
-		"notice_sha256": existingSum,
-		"new_sha256":    newSum,
-	}).Info("calculated sha256 file sums")
 
-	if existingSum != newSum {
-		return errors.Errorf("NOTICE file needs to be updated")
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, name := range checkNames() {
+		state := "disabled"
+		if enabled[name] {
+			state = "enabled"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, state, checks[name].Description())
 	}
-	return nil
+	return w.Flush()
 }
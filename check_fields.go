@@ -0,0 +1,73 @@
+package main
+
+import "os"
+
+func init() {
+	registerCheck(fieldsCheck{})
+}
+
+// fieldsCheckArtifacts describes the artifacts generated from the fields that
+// are compared by the fields check. Artifacts disabled in the update config
+// are not compared.
+var fieldsCheckArtifacts = map[string]string{
+	"fields-docs": "field documentation",
+	"template":    "Elasticsearch template",
+	"kibana":      "Kibana index pattern",
+}
+
+// fieldsCheck validates the fields.yml files of a Beat and reports when the
+// field documentation, Elasticsearch template, or Kibana index pattern
+// generated from them is out of date.
+type fieldsCheck struct{}
+
+func (fieldsCheck) Name() string { return "fields" }
+func (fieldsCheck) Description() string {
+	return "Validate the Beat's fields.yml files and check that the files generated from them are up to date"
+}
+
+func (c fieldsCheck) Run(opts CheckOptions) ([]Finding, error) {
+	fields, findings, err := loadBeatFields(c.Name())
+	if err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		checkLog.Info("fields check skipped because the project has no fields.yml files")
+		return nil, nil
+	}
+
+	findings = append(findings, validateFields(c.Name(), fields.Sections)...)
+
+	artifacts, err := selectArtifacts(fieldsArtifacts(fields), nil, projectConfig.Update.Disabled)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range artifacts {
+		description, found := fieldsCheckArtifacts[a.Name]
+		if !found {
+			continue
+		}
+		if _, err := os.Stat(a.Path); os.IsNotExist(err) {
+			findings = append(findings, Finding{
+				Check:    c.Name(),
+				File:     a.Path,
+				Message:  description + " is missing (run bake update)",
+				Severity: SeverityError,
+			})
+			continue
+		}
+		_, upToDate, err := a.check()
+		if err != nil {
+			return nil, err
+		}
+		if !upToDate {
+			findings = append(findings, Finding{
+				Check:    c.Name(),
+				File:     a.Path,
+				Message:  description + " is out of date with the fields.yml files (run bake update)",
+				Severity: SeverityError,
+			})
+		}
+	}
+
+	return findings, nil
+}
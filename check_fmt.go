@@ -0,0 +1,34 @@
+package main
+
+func init() {
+	registerCheck(fmtCheck{})
+}
+
+// fmtCheck reports Go files that are not formatted with gofmt -s.
+type fmtCheck struct{}
+
+func (fmtCheck) Name() string        { return "fmt" }
+func (fmtCheck) Description() string { return "Check that Go files are formatted with gofmt -s" }
+
+func (c fmtCheck) Run(opts CheckOptions) ([]Finding, error) {
+	files, err := opts.GoFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := formatFiles(files, gofmtSource)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, f := range changed {
+		findings = append(findings, Finding{
+			Check:    c.Name(),
+			File:     f.File,
+			Message:  "file needs to be formatted with gofmt -s (run bake fmt)",
+			Severity: SeverityError,
+		})
+	}
+	return findings, nil
+}
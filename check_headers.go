@@ -0,0 +1,47 @@
+package main
+
+func init() {
+	registerCheck(headersCheck{})
+}
+
+// headersCheck reports Go files that do not begin with the license header
+// configured for the project.
+type headersCheck struct{}
+
+func (headersCheck) Name() string { return "headers" }
+func (headersCheck) Description() string {
+	return "Check that non-generated Go files begin with the project's license header"
+}
+
+func (c headersCheck) Run(opts CheckOptions) ([]Finding, error) {
+	header, err := projectConfig.Headers.LicenseHeader()
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		checkLog.Info("headers check skipped because no header template is configured")
+		return nil, nil
+	}
+
+	files, err := opts.GoFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	missing, err := missingHeaders(header, files)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, f := range missing {
+		findings = append(findings, Finding{
+			Check:    c.Name(),
+			File:     f,
+			Line:     1,
+			Message:  "missing license header (run bake fmt --headers)",
+			Severity: SeverityError,
+		})
+	}
+	return findings, nil
+}
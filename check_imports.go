@@ -0,0 +1,41 @@
+package main
+
+func init() {
+	registerCheck(importsCheck{})
+}
+
+// importsCheck reports Go files whose imports are not sorted and grouped as
+// standard library, third-party, then local packages.
+type importsCheck struct{}
+
+func (importsCheck) Name() string { return "imports" }
+func (importsCheck) Description() string {
+	return "Check that imports are grouped as stdlib, third-party, then local packages"
+}
+
+func (c importsCheck) Run(opts CheckOptions) ([]Finding, error) {
+	files, err := opts.GoFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	local := projectConfig.Imports.LocalPrefixes()
+
+	var findings []Finding
+	for _, f := range files {
+		line, err := checkImports(f, local)
+		if err != nil {
+			return nil, err
+		}
+		if line > 0 {
+			findings = append(findings, Finding{
+				Check:    c.Name(),
+				File:     f,
+				Line:     line,
+				Message:  "imports need to be grouped and sorted (run bake fmt)",
+				Severity: SeverityError,
+			})
+		}
+	}
+	return findings, nil
+}
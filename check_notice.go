@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCheck(noticeCheck{})
+}
+
+// noticeCheck reports when the NOTICE file is out of date.
+type noticeCheck struct{}
+
+func (noticeCheck) Name() string        { return "notice" }
+func (noticeCheck) Description() string { return "Check that the NOTICE file is up to date" }
+
+func (c noticeCheck) Run(opts CheckOptions) ([]Finding, error) {
+	upToDate, err := checkNotice()
+	if err != nil {
+		return nil, err
+	}
+
+	if upToDate {
+		return nil, nil
+	}
+
+	return []Finding{{
+		Check:    c.Name(),
+		File:     getNoticeCommandDefaults().Output,
+		Message:  "NOTICE file needs to be updated (run bake notice)",
+		Severity: SeverityError,
+	}}, nil
+}
+
+// checkNotice returns true if the existing NOTICE file matches a newly
+// generated NOTICE.
+func checkNotice() (bool, error) {
+	existing, err := ioutil.ReadFile(getNoticeCommandDefaults().Output)
+	if err != nil {
+		return false, errors.Wrap(err, "failed reading existing NOTICE file")
+	}
+
+	notice, err := generateNoticeData()
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(existing, notice), nil
+}
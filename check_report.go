@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// reportFormatter writes the results of the checks to w.
+type reportFormatter func(w io.Writer, results []checkResult) error
+
+// reportFormats contains the output formats supported by bake check --format.
+var reportFormats = map[string]reportFormatter{
+	"text":       textReport,
+	"json":       jsonReport,
+	"checkstyle": checkstyleReport,
+	"sarif":      sarifReport,
+	"github":     githubReport,
+}
+
+func reportFormatNames() []string {
+	names := make([]string, 0, len(reportFormats))
+	for name := range reportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// allFindings returns the findings of all results in order.
+func allFindings(results []checkResult) []Finding {
+	var findings []Finding
+	for _, r := range results {
+		findings = append(findings, r.Findings...)
+	}
+	return findings
+}
+
+// projectRelativePath returns the path of file relative to the project root
+// using forward slashes. This is the form expected by CI systems that
+// annotate files in the repository. Files outside of the project are returned
+// unchanged.
+func projectRelativePath(file string) string {
+	if file == "" {
+		return ""
+	}
+
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	rel, err := filepath.Rel(ProjectRootAbs, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(file)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Text
+
+func textReport(w io.Writer, results []checkResult) error {
+	for _, f := range allFindings(results) {
+		if _, err := fmt.Fprintln(w, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSON
+
+type jsonCheckResult struct {
+	Name       string `json:"name"`
+	Passed     bool   `json:"passed"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+func jsonReport(w io.Writer, results []checkResult) error {
+	report := struct {
+		Checks   []jsonCheckResult `json:"checks"`
+		Findings []Finding         `json:"findings"`
+	}{
+		Checks:   []jsonCheckResult{},
+		Findings: []Finding{},
+	}
+
+	for _, r := range results {
+		jr := jsonCheckResult{
+			Name:       r.Name,
+			Passed:     r.Passed(),
+			DurationMs: int64(r.Duration / 1e6),
+		}
+		if r.Err != nil {
+			jr.Error = r.Err.Error()
+		}
+		report.Checks = append(report.Checks, jr)
+	}
+	report.Findings = append(report.Findings, allFindings(results)...)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// Checkstyle XML
+
+type checkstyleXML struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr,omitempty"`
+	Column   int    `xml:"column,attr,omitempty"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+func checkstyleReport(w io.Writer, results []checkResult) error {
+	report := checkstyleXML{Version: "4.3"}
+
+	files := map[string]int{}
+	for _, f := range allFindings(results) {
+		name := projectRelativePath(f.File)
+		if name == "" {
+			name = "."
+		}
+
+		i, found := files[name]
+		if !found {
+			i = len(report.Files)
+			files[name] = i
+			report.Files = append(report.Files, checkstyleFile{Name: name})
+		}
+
+		report.Files[i].Errors = append(report.Files[i].Errors, checkstyleError{
+			Line:     f.Line,
+			Column:   f.Column,
+			Severity: string(f.Severity),
+			Message:  f.Message,
+			Source:   "bake." + f.Check,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// SARIF (Static Analysis Results Interchange Format) v2.1.0
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+func sarifLevel(s Severity) string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+func sarifReport(w io.Writer, results []checkResult) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "bake",
+			InformationURI: "https://github.com/andrewkroh/bake",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	for _, r := range results {
+		description := r.Name
+		if c, found := checks[r.Name]; found {
+			description = c.Description()
+		}
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               r.Name,
+			ShortDescription: sarifMessage{Text: description},
+		})
+	}
+
+	for _, f := range allFindings(results) {
+		result := sarifResult{
+			RuleID:  f.Check,
+			Level:   sarifLevel(f.Severity),
+			Message: sarifMessage{Text: f.Message},
+		}
+		if f.File != "" {
+			loc := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: projectRelativePath(f.File)},
+			}}
+			if f.Line > 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line, StartColumn: f.Column}
+			}
+			result.Locations = append(result.Locations, loc)
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}})
+}
+
+// GitHub Actions workflow commands
+
+var (
+	githubDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+func githubCommand(s Severity) string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "notice"
+	default:
+		return "error"
+	}
+}
+
+func githubReport(w io.Writer, results []checkResult) error {
+	for _, f := range allFindings(results) {
+		var props []string
+		if f.File != "" {
+			props = append(props, "file="+githubPropertyEscaper.Replace(projectRelativePath(f.File)))
+		}
+		if f.Line > 0 {
+			props = append(props, "line="+strconv.Itoa(f.Line))
+		}
+		if f.Column > 0 {
+			props = append(props, "col="+strconv.Itoa(f.Column))
+		}
+		props = append(props, "title="+githubPropertyEscaper.Replace("bake "+f.Check))
+
+		if _, err := fmt.Fprintf(w, "::%s %s::%s\n", githubCommand(f.Severity), strings.Join(props, ","), githubDataEscaper.Replace(f.Message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
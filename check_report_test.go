@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var reportTestResults = []checkResult{
+	{
+		Name: "vet",
+		Findings: []Finding{
+			{Check: "vet", File: "docker.go", Line: 12, Column: 3, Message: "unreachable code", Severity: SeverityError},
+		},
+	},
+	{
+		Name: "notice",
+		Findings: []Finding{
+			{Check: "notice", Message: "NOTICE file needs to be updated, 100%", Severity: SeverityWarning},
+		},
+	},
+}
+
+func TestParseGoPositionFinding(t *testing.T) {
+	f := parseGoPositionFinding("vet", "common/common.go:42:7: result of fmt.Sprintf call not used")
+	assert.Equal(t, Finding{
+		Check:    "vet",
+		File:     "common/common.go",
+		Line:     42,
+		Column:   7,
+		Message:  "result of fmt.Sprintf call not used",
+		Severity: SeverityError,
+	}, f)
+	assert.Equal(t, "common/common.go:42:7", f.Position())
+
+	f = parseGoPositionFinding("vet", "exit status 1")
+	assert.Equal(t, "", f.File)
+	assert.Equal(t, "exit status 1", f.Message)
+}
+
+func TestTextReport(t *testing.T) {
+	buf := new(bytes.Buffer)
+	assert.NoError(t, textReport(buf, reportTestResults))
+	assert.Equal(t, "docker.go:12:3: unreachable code (vet)\n"+
+		"NOTICE file needs to be updated, 100% (notice)\n", buf.String())
+}
+
+func TestGithubReport(t *testing.T) {
+	buf := new(bytes.Buffer)
+	assert.NoError(t, githubReport(buf, reportTestResults))
+	assert.Equal(t, "::error file=docker.go,line=12,col=3,title=bake vet::unreachable code\n"+
+		"::warning title=bake notice::NOTICE file needs to be updated, 100%25\n", buf.String())
+}
+
+func TestCheckstyleReport(t *testing.T) {
+	buf := new(bytes.Buffer)
+	assert.NoError(t, checkstyleReport(buf, reportTestResults[:1]))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<checkstyle version="4.3">
+  <file name="docker.go">
+    <error line="12" column="3" severity="error" message="unreachable code" source="bake.vet"></error>
+  </file>
+</checkstyle>
+`, buf.String())
+}
+
+func TestSarifReport(t *testing.T) {
+	buf := new(bytes.Buffer)
+	assert.NoError(t, sarifReport(buf, reportTestResults))
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "2.1.0", log.Version)
+	if assert.Len(t, log.Runs, 1) && assert.Len(t, log.Runs[0].Results, 2) {
+		vet := log.Runs[0].Results[0]
+		assert.Equal(t, "vet", vet.RuleID)
+		assert.Equal(t, "error", vet.Level)
+		assert.Equal(t, "docker.go", vet.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+		assert.Equal(t, 12, vet.Locations[0].PhysicalLocation.Region.StartLine)
+
+		notice := log.Runs[0].Results[1]
+		assert.Equal(t, "note", sarifLevel(SeverityInfo))
+		assert.Equal(t, "warning", notice.Level)
+		assert.Empty(t, notice.Locations)
+	}
+}
+
+func TestJSONReport(t *testing.T) {
+	buf := new(bytes.Buffer)
+	assert.NoError(t, jsonReport(buf, reportTestResults))
+
+	var report struct {
+		Checks   []jsonCheckResult
+		Findings []Finding
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, report.Checks, 2)
+	assert.False(t, report.Checks[0].Passed)
+	assert.True(t, report.Checks[1].Passed, "warnings do not fail a check")
+	assert.Equal(t, reportTestResults[0].Findings[0], report.Findings[0])
+}
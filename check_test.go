@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckRegistry(t *testing.T) {
+	for _, name := range []string{"fmt", "vet", "notice"} {
+		c, found := checks[name]
+		if assert.True(t, found, name) {
+			assert.Equal(t, name, c.Name())
+			assert.NotEmpty(t, c.Description())
+		}
+	}
+}
+
+func TestSelectChecks(t *testing.T) {
+	selected, err := selectChecks(nil, CheckConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, checkNames(), selected)
+
+	selected, err = selectChecks(nil, CheckConfig{Disabled: []string{"vet"}})
+	assert.NoError(t, err)
+	assert.NotContains(t, selected, "vet")
+	assert.Contains(t, selected, "fmt")
+
+	selected, err = selectChecks(nil, CheckConfig{Enabled: []string{"fmt", "vet"}, Disabled: []string{"vet"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"fmt"}, selected)
+
+	// Checks requested explicitly are run even when disabled.
+	selected, err = selectChecks([]string{"vet"}, CheckConfig{Disabled: []string{"vet"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vet"}, selected)
+
+	_, err = selectChecks(nil, CheckConfig{Disabled: []string{"bogus"}})
+	assert.Error(t, err)
+}
+
+type fakeCheck struct {
+	name     string
+	delay    time.Duration
+	findings []Finding
+	err      error
+}
+
+func (c fakeCheck) Name() string        { return c.name }
+func (c fakeCheck) Description() string { return "fake" }
+func (c fakeCheck) Run(opts CheckOptions) ([]Finding, error) {
+	time.Sleep(c.delay)
+	return c.findings, c.err
+}
+
+func TestRunChecks(t *testing.T) {
+	fakes := []fakeCheck{
+		{name: "fake-slow", delay: 20 * time.Millisecond},
+		{name: "fake-findings", findings: []Finding{{Message: "bad"}}},
+		{name: "fake-error", err: errors.New("boom")},
+	}
+	var names []string
+	for _, c := range fakes {
+		checks[c.name] = c
+		defer delete(checks, c.name)
+		names = append(names, c.name)
+	}
+
+	results := runChecks(names, CheckOptions{}, 2)
+	if assert.Len(t, results, 3) {
+		// Results are in the requested order regardless of completion order.
+		assert.Equal(t, "fake-slow", results[0].Name)
+		assert.True(t, results[0].Passed())
+		assert.True(t, results[0].Duration >= 20*time.Millisecond)
+
+		assert.Equal(t, "fake-findings", results[1].Name)
+		assert.False(t, results[1].Passed())
+
+		assert.Equal(t, "fake-error", results[2].Name)
+		assert.Error(t, results[2].Err)
+	}
+}
+
+func TestParseVetOutput(t *testing.T) {
+	out := `# example.com/b
+vet: b/b.go:3:19: too many return values
+	have (number)
+	want ()
+{
+	"example.com/a": {
+		"printf": [
+			{
+				"posn": "/src/a/a.go:6:14",
+				"end": "/src/a/a.go:6:16",
+				"message": "fmt.Printf format %d has arg \"x\" of wrong type string"
+			}
+		],
+		"assign": [
+			{
+				"posn": "/src/a/a.go:8:2",
+				"message": "self-assignment of x"
+			}
+		],
+		"nilness": {
+			"error": "analysis failed"
+		},
+		"unusedwrite": {
+			"error": "analysis skipped due to errors in package"
+		},
+		"lostcancel": {
+			"error": "failed prerequisites: ctrlflow@example.com/a"
+		}
+	}
+}
+`
+
+	findings, unparsed := parseVetOutput(out)
+	assert.Empty(t, unparsed)
+	assert.Equal(t, []Finding{
+		{Check: "vet", Message: "nilness: analysis failed", Severity: SeverityError},
+		{Check: "vet", File: "/src/a/a.go", Line: 6, Column: 14, Message: `printf: fmt.Printf format %d has arg "x" of wrong type string`, Severity: SeverityError},
+		{Check: "vet", File: "/src/a/a.go", Line: 8, Column: 2, Message: "assign: self-assignment of x", Severity: SeverityError},
+		{Check: "vet", File: "b/b.go", Line: 3, Column: 19, Message: "too many return values; have (number); want ()", Severity: SeverityError},
+	}, findings)
+
+	_, unparsed = parseVetOutput("flag provided but not defined: -nosuch\n")
+	assert.Equal(t, []string{"flag provided but not defined: -nosuch"}, unparsed)
+
+	// Diagnostics reported for a package and its test variant are merged.
+	findings, _ = parseVetOutput("{\n\t\"a\": {\"printf\": [{\"posn\": \"a.go:1:2\", \"message\": \"m\"}]},\n" +
+		"\t\"a [a.test]\": {\"printf\": [{\"posn\": \"a.go:1:2\", \"message\": \"m\"}]}\n}\n")
+	assert.Len(t, findings, 1)
+
+	// Truncated output.
+	_, unparsed = parseVetOutput("# pkg\n{\n\t\"pkg\": {\n")
+	assert.Equal(t, []string{"{\n\t\"pkg\": {\n"}, unparsed)
+}
+
+func TestCheckVet(t *testing.T) {
+	dir := writeFieldsFiles(t, map[string]string{
+		"go.mod": "module example.com/vettest\n\ngo 1.20\n",
+		"main.go": `package main
+
+import "fmt"
+
+func deref(p *int) int {
+	if p == nil {
+		return *p
+	}
+	return 0
+}
+
+func main() {
+	fmt.Printf("%d\n", "x")
+}
+`,
+	})
+	defer os.RemoveAll(dir)
+	defer useTestProject(t, dir, &ProjectConfig{})()
+
+	findings, err := checkVet([]string{"-printf", "-nilness"}, []string{"."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "main.go")
+	if assert.Len(t, findings, 2) {
+		assert.Equal(t, Finding{Check: "vet", File: file, Line: 7, Column: 10,
+			Message: "nilness: nil dereference in load", Severity: SeverityError}, findings[0])
+		assert.Equal(t, file, findings[1].File)
+		assert.Equal(t, 13, findings[1].Line)
+		assert.Contains(t, findings[1].Message, "printf: ")
+	}
+}
+
+func TestVetConfigFlags(t *testing.T) {
+	flags, err := VetConfig{Enabled: []string{"printf", "nilness"}, Disabled: []string{"composites"}}.Flags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"-printf=true", "-nilness=true", "-composites=false"}, flags)
+
+	// Opt-in analyzers are disabled unless analyzers are enabled explicitly.
+	flags, err = VetConfig{Disabled: []string{"composites"}}.Flags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"-composites=false", "-shadow=false"}, flags)
+
+	_, err = VetConfig{Disabled: []string{"nosuch"}}.Flags()
+	assert.Error(t, err)
+}
@@ -0,0 +1,46 @@
+package main
+
+func init() {
+	registerCheck(updateCheck{})
+}
+
+// updateCheck reports generated artifacts that are out of date, except for
+// those that are reported by the fields check.
+type updateCheck struct{}
+
+func (updateCheck) Name() string { return "update" }
+func (updateCheck) Description() string {
+	return "Check that the files generated by bake update are up to date"
+}
+
+func (c updateCheck) Run(opts CheckOptions) ([]Finding, error) {
+	artifacts, err := projectArtifacts()
+	if err != nil {
+		return nil, err
+	}
+	artifacts, err = selectArtifacts(artifacts, nil, projectConfig.Update.Disabled)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, a := range artifacts {
+		// The fields check reports the artifacts generated from the fields.
+		if _, found := fieldsCheckArtifacts[a.Name]; found {
+			continue
+		}
+		_, upToDate, err := a.check()
+		if err != nil {
+			return nil, err
+		}
+		if !upToDate {
+			findings = append(findings, Finding{
+				Check:    c.Name(),
+				File:     a.Path,
+				Message:  a.Name + " is out of date (run bake update)",
+				Severity: SeverityError,
+			})
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/multichecker"
+	"golang.org/x/tools/go/analysis/passes/deepequalerrors"
+	"golang.org/x/tools/go/analysis/passes/nilness"
+	"golang.org/x/tools/go/analysis/passes/reflectvaluecompare"
+	"golang.org/x/tools/go/analysis/passes/shadow"
+	"golang.org/x/tools/go/analysis/passes/sortslice"
+	"golang.org/x/tools/go/analysis/passes/unusedwrite"
+	"golang.org/x/tools/go/analysis/suite/vet"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func init() {
+	registerCheck(vetCheck{})
+}
+
+// vetAnalyzers are the analyzers run by the vet check: those of go vet plus
+// analyzers from golang.org/x/tools that go vet does not run.
+var vetAnalyzers = append(vet.Suite[:len(vet.Suite):len(vet.Suite)],
+	deepequalerrors.Analyzer,
+	nilness.Analyzer,
+	reflectvaluecompare.Analyzer,
+	shadow.Analyzer,
+	sortslice.Analyzer,
+	unusedwrite.Analyzer,
+)
+
+// vetOptInAnalyzers are not run unless they are enabled explicitly. Like go
+// vet, bake considers shadow too noisy (it reports the common shadowing of
+// err) to run by default.
+var vetOptInAnalyzers = []string{shadow.Analyzer.Name}
+
+// vetCommand is the hidden command that the vet check runs in a child process
+// to run the analyzers as a multichecker.
+const vetCommand = "__vet"
+
+func registerVetCommand(app *kingpin.Application) {
+	app.Command(vetCommand, "Run the vet analyzers as a multichecker with the arguments following --.").Hidden().Action(runVetMultichecker)
+}
+
+// runVetMultichecker runs the analyzers as a multichecker with the
+// passthrough arguments. It exits the process when it is done.
+func runVetMultichecker(ctx *kingpin.ParseContext) error {
+	os.Args = append([]string{os.Args[0]}, PassthroughArgs...)
+	multichecker.Main(vetAnalyzers...) // Never returns.
+	return nil
+}
+
+// findAnalyzer returns the vet analyzer with the given name or nil.
+func findAnalyzer(name string) *analysis.Analyzer {
+	for _, a := range vetAnalyzers {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// vetCheck reports problems found by the vet analyzers.
+type vetCheck struct{}
+
+func (vetCheck) Name() string        { return "vet" }
+func (vetCheck) Description() string { return "Run vet analyzers on non-vendor packages" }
+
+func (c vetCheck) Run(opts CheckOptions) ([]Finding, error) {
+	packages, err := opts.GoPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	flags, err := projectConfig.Vet.Flags()
+	if err != nil {
+		return nil, err
+	}
+
+	return checkVet(flags, packages)
+}
+
+// checkVet runs the analyzers on the given packages and returns their
+// diagnostics. Type checking errors are reported as findings too. The
+// analyzers are run by bake's hidden vet command in a child process because
+// the multichecker exits when it is done.
+func checkVet(flags, packages []string) ([]Finding, error) {
+	if len(packages) == 0 {
+		return nil, nil
+	}
+
+	bake, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{vetCommand, "--", "-json"}
+	args = append(args, flags...)
+	args = append(args, packages...)
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	cmd := exec.Command(bake, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	runErr := cmd.Run()
+
+	// The JSON is written to stdout and type checking errors to stderr.
+	findings, unparsed := parseVetOutput(stdout.String() + "\n" + stderr.String())
+	if runErr != nil && (len(unparsed) > 0 || len(findings) == 0) {
+		return nil, errors.Errorf(`vet analyzers failed (args="%v"): %v (stderr=%v)`,
+			strings.Join(args, " "), runErr, strings.TrimSpace(stderr.String()))
+	}
+	return findings, nil
+}
+
+// vetDiagnostic is a diagnostic in the JSON output of the multichecker.
+type vetDiagnostic struct {
+	Posn    string `json:"posn"`
+	Message string `json:"message"`
+}
+
+// parseVetOutput parses the output of the multichecker or go vet run with
+// -json. The output consists of
+// JSON objects mapping package to analyzer to diagnostics, interleaved with
+// "# package" headers and "vet: " errors for packages that failed to type
+// check. It returns the findings and any lines that could not be parsed.
+func parseVetOutput(out string) ([]Finding, []string) {
+	var findings []Finding
+	var unparsed []string
+
+	lines := strings.Split(out, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		switch {
+		case strings.TrimSpace(line) == "", strings.HasPrefix(line, "# "):
+		case line == "{":
+			// Collect the object up to its closing brace. The object is
+			// unterminated when the output was truncated.
+			start := i
+			for i < len(lines) && strings.TrimRight(lines[i], "\r") != "}" {
+				i++
+			}
+			if i == len(lines) {
+				unparsed = append(unparsed, strings.Join(lines[start:], "\n"))
+				break
+			}
+			obj := strings.Join(lines[start:i+1], "\n")
+
+			f, err := parseVetJSON([]byte(obj))
+			if err != nil {
+				unparsed = append(unparsed, obj)
+				continue
+			}
+			findings = append(findings, f...)
+		case strings.HasPrefix(line, "\t") && len(findings) > 0:
+			// Continuation of a multi-line type checking error.
+			findings[len(findings)-1].Message += "; " + strings.TrimSpace(line)
+		default:
+			msg := strings.TrimPrefix(line, "vet: ")
+			if !goPositionRegex.MatchString(msg) {
+				unparsed = append(unparsed, line)
+				continue
+			}
+			findings = append(findings, parseGoPositionFinding(vetCheck{}.Name(), msg))
+		}
+	}
+
+	for i := range findings {
+		findings[i].File = cwdRelativePath(findings[i].File)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	// A package and its test variant report the same diagnostics.
+	unique := findings[:0]
+	for i, f := range findings {
+		if i > 0 && f == findings[i-1] {
+			continue
+		}
+		unique = append(unique, f)
+	}
+	return unique, unparsed
+}
+
+// vetSkippedError is the error of every analyzer when a package has type
+// checking errors. Analyzers depending on a skipped analyzer fail with
+// vetPrerequisitesError.
+const (
+	vetSkippedError       = "analysis skipped due to errors in package"
+	vetPrerequisitesError = "failed prerequisites: "
+)
+
+// parseVetJSON converts a JSON object written with -json to findings.
+// Each message is prefixed with the name of the analyzer that reported it.
+func parseVetJSON(data []byte) ([]Finding, error) {
+	var pkgs map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(data, &pkgs); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, analyzers := range pkgs {
+		for analyzer, raw := range analyzers {
+			var diags []vetDiagnostic
+			if err := json.Unmarshal(raw, &diags); err != nil {
+				// An analyzer that fails reports {"error": "..."}.
+				var failure struct {
+					Error string `json:"error"`
+				}
+				if err := json.Unmarshal(raw, &failure); err != nil {
+					return nil, err
+				}
+				if failure.Error == vetSkippedError || strings.HasPrefix(failure.Error, vetPrerequisitesError) {
+					// The type checking errors are reported instead.
+					continue
+				}
+				findings = append(findings, Finding{
+					Check:    vetCheck{}.Name(),
+					Message:  analyzer + ": " + failure.Error,
+					Severity: SeverityError,
+				})
+				continue
+			}
+
+			for _, d := range diags {
+				f := parseGoPositionFinding(vetCheck{}.Name(), d.Posn+": "+d.Message)
+				f.Message = analyzer + ": " + f.Message
+				findings = append(findings, f)
+			}
+		}
+	}
+	return findings, nil
+}
+
+// cwdRelativePath returns the path relative to the current directory if the
+// path is absolute and beneath it. Otherwise the path is returned unchanged.
+func cwdRelativePath(path string) string {
+	if !filepath.IsAbs(path) || CWD == "" {
+		return path
+	}
+	rel, err := filepath.Rel(CWD, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
@@ -2,7 +2,9 @@ package common
 
 import (
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
+	"hash"
 	"io"
 	"os"
 	"os/exec"
@@ -73,10 +75,8 @@ func GoFiles() ([]string, error) {
 		}
 
 		// Filter vendor
-		for _, dir := range strings.Split(path, string(filepath.Separator)) {
-			if dir == "vendor" {
-				return nil
-			}
+		if isVendorPath(path) {
+			return nil
 		}
 
 		files = append(files, path)
@@ -86,6 +86,16 @@ func GoFiles() ([]string, error) {
 	return files, filepath.Walk(".", callback)
 }
 
+// isVendorPath returns true if any element of the path is a vendor directory.
+func isVendorPath(path string) bool {
+	for _, dir := range strings.Split(path, string(filepath.Separator)) {
+		if dir == "vendor" {
+			return true
+		}
+	}
+	return false
+}
+
 // GoPackages return a list of non-vendor go packages.
 func GoPackages() ([]string, error) {
 	out, err := RunCommand(exec.Command("go", "list", "./..."))
@@ -115,16 +125,23 @@ outer:
 
 // Sha256Sum returns a hex encoded sha256 sum of the specified file.
 func Sha256Sum(file string) (string, error) {
+	return hashFile(file, sha256.New(), "sha256")
+}
+
+// Sha512Sum returns a hex encoded sha512 sum of the specified file.
+func Sha512Sum(file string) (string, error) {
+	return hashFile(file, sha512.New(), "sha512")
+}
+
+func hashFile(file string, h hash.Hash, name string) (string, error) {
 	f, err := os.Open(file)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to open file for sha256 sum")
+		return "", errors.Wrapf(err, "failed to open file for %v sum", name)
 	}
 	defer f.Close()
 
-	h := sha256.New()
-
 	if _, err := io.Copy(h, f); err != nil {
-		return "", errors.Wrap(err, "failed to calculate sha256 sum")
+		return "", errors.Wrapf(err, "failed to calculate %v sum", name)
 	}
 
 	return hex.EncodeToString(h.Sum(nil)), nil
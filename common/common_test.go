@@ -1,6 +1,8 @@
 package common
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -19,3 +21,23 @@ func TestCommonFindGitProjectRoot(t *testing.T) {
 	}
 	assert.Equal(t, expectedRoot, root)
 }
+
+func TestSha512Sum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bake-common")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hello.txt")
+	writeFile(t, file, "hello\n")
+
+	sum, err := Sha512Sum(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// echo hello | sha512sum
+	assert.Equal(t, "e7c22b994c59d9cf2b48e549b1e24666636045930d3da7c1acb299d1c3b7f931f94aae41edda2c2b207a36e10f8bcb8d45223e54878f5b316e7ce3b6bc019629", sum)
+
+	_, err = Sha512Sum(filepath.Join(dir, "missing.txt"))
+	assert.Error(t, err)
+}
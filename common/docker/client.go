@@ -0,0 +1,344 @@
+// Package docker contains a minimal client for the Docker Engine API. It only
+// implements the few calls that bake needs in order to discover the
+// containers and published ports belonging to a docker-compose project and to
+// look up and pull the images used for builds.
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultHost is the address of the Docker daemon used when DOCKER_HOST
+	// is not set.
+	DefaultHost = "unix:///var/run/docker.sock"
+
+	// APIVersion is the Docker Engine API version used for requests. It is
+	// the oldest version supporting all of the requests made by the client.
+	APIVersion = "1.24"
+)
+
+// Labels that docker-compose sets on the containers it creates.
+const (
+	LabelProject         = "com.docker.compose.project"
+	LabelService         = "com.docker.compose.service"
+	LabelContainerNumber = "com.docker.compose.container-number"
+)
+
+var log = logrus.WithField("package", "common.docker")
+
+// Client is a Docker Engine API client.
+type Client struct {
+	host    string
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient returns a new Client for the daemon listening at host. Host must
+// be of the form unix:///path/to/socket or tcp://host:port. If host is empty
+// then the value of DOCKER_HOST is used, and if that is not set the
+// DefaultHost is used.
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultHost
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid docker host %v", host)
+	}
+
+	transport := &http.Transport{}
+	baseURL := "http://docker"
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+	case "tcp", "http":
+		baseURL = "http://" + u.Host
+	default:
+		return nil, errors.Errorf("unsupported docker host scheme %v (host=%v)", u.Scheme, host)
+	}
+
+	return &Client{
+		host:    host,
+		baseURL: baseURL,
+		http:    &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Host returns the address of the daemon used by the client.
+func (c *Client) Host() string {
+	return c.host
+}
+
+// Ping checks that the daemon is reachable.
+func (c *Client) Ping() error {
+	_, err := c.get("/_ping", nil)
+	return err
+}
+
+// Containers returns the containers (running or not) having all of the given
+// labels.
+func (c *Client) Containers(labels map[string]string) ([]Container, error) {
+	var labelFilters []string
+	for k, v := range labels {
+		labelFilters = append(labelFilters, k+"="+v)
+	}
+	sort.Strings(labelFilters)
+
+	filters, err := json.Marshal(map[string][]string{"label": labelFilters})
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("all", "1")
+	query.Set("filters", string(filters))
+
+	body, err := c.get("/containers/json", query)
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []Container
+	if err := json.Unmarshal(body, &containers); err != nil {
+		return nil, errors.Wrap(err, "failed to decode container list")
+	}
+	return containers, nil
+}
+
+// ProjectContainers returns all containers belonging to the given
+// docker-compose project.
+func (c *Client) ProjectContainers(project string) ([]Container, error) {
+	return c.Containers(map[string]string{LabelProject: project})
+}
+
+// ImageID returns the ID of the local image with the given name. It returns
+// an empty string if the image does not exist locally.
+func (c *Client) ImageID(name string) (string, error) {
+	body, err := c.get("/images/"+name+"/json", nil)
+	if err != nil {
+		if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+
+	var image struct {
+		ID string `json:"Id"`
+	}
+	if err := json.Unmarshal(body, &image); err != nil {
+		return "", errors.Wrap(err, "failed to decode image")
+	}
+	return image.ID, nil
+}
+
+// ImagePull pulls the image with the given name. A name without a tag or
+// digest pulls the latest tag.
+func (c *Client) ImagePull(name string) error {
+	image, tag := splitImageName(name)
+	query := url.Values{}
+	query.Set("fromImage", image)
+	query.Set("tag", tag)
+
+	// Pulling can take much longer than the timeout of other requests.
+	client := *c.http
+	client.Timeout = 0
+	body, err := c.do(&client, http.MethodPost, "/images/create", query)
+	if err != nil {
+		return errors.Wrapf(err, "failed to pull %v", name)
+	}
+
+	// Errors that occur once the pull has started are reported in the
+	// stream of progress messages.
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "failed to decode image pull progress")
+		}
+		if msg.Error != "" {
+			return errors.Errorf("failed to pull %v: %v", name, msg.Error)
+		}
+	}
+}
+
+// splitImageName splits an image name into the repository and the tag or
+// digest. The tag defaults to latest.
+func splitImageName(name string) (string, string) {
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		return name[:i], name[i+1:]
+	}
+	return name, "latest"
+}
+
+func (c *Client) get(path string, query url.Values) ([]byte, error) {
+	return c.do(c.http, http.MethodGet, path, query)
+}
+
+func (c *Client) do(client *http.Client, method, path string, query url.Values) ([]byte, error) {
+	u := c.baseURL + "/v" + APIVersion + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("method", method).WithField("url", u).Debug("docker api request")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "docker api request to %v failed", c.host)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading docker api response")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{Path: path, StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(body))
+		}
+		return nil, apiErr
+	}
+
+	return body, nil
+}
+
+// APIError is an error response from the Docker Engine API.
+type APIError struct {
+	Path       string `json:"-"`
+	StatusCode int    `json:"-"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("docker api error (path=%v, status=%v): %v", e.Path, e.StatusCode, e.Message)
+}
+
+// Container is a summary of a container as returned by the list containers
+// API.
+type Container struct {
+	ID     string `json:"Id"`
+	Names  []string
+	Image  string
+	State  string
+	Labels map[string]string
+	Ports  []Port
+}
+
+// Service returns the docker-compose service name of the container.
+func (c Container) Service() string {
+	return c.Labels[LabelService]
+}
+
+// Number returns the docker-compose container number (the instance index of a
+// scaled service). It returns 1 if the label is not present.
+func (c Container) Number() int {
+	n, err := strconv.Atoi(c.Labels[LabelContainerNumber])
+	if err != nil {
+		return 1
+	}
+	return n
+}
+
+// PublishedPorts returns the ports of the container that are published on the
+// host. Docker reports a port that is published on both the IPv4 and IPv6
+// wildcard addresses twice, so only one binding is returned for each
+// container port and the IPv4 binding is preferred.
+func (c Container) PublishedPorts() []Port {
+	var ports []Port
+	index := map[string]int{}
+	for _, p := range c.Ports {
+		if p.PublicPort == 0 {
+			continue
+		}
+		key := fmt.Sprintf("%d/%s", p.PrivatePort, p.Type)
+		if i, found := index[key]; found {
+			if isIPv6(ports[i].IP) && !isIPv6(p.IP) {
+				ports[i] = p
+			}
+			continue
+		}
+		index[key] = len(ports)
+		ports = append(ports, p)
+	}
+	return ports
+}
+
+func isIPv6(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.To4() == nil
+}
+
+// Port is a container port and its mapping on the host.
+type Port struct {
+	IP          string
+	PrivatePort int
+	PublicPort  int
+	Type        string
+}
+
+// HostAddress returns the host and port that can be used to connect to the
+// published port. Wildcard bind addresses are replaced with loopback.
+func (p Port) HostAddress() (string, string) {
+	return LocalHost(p.IP), strconv.Itoa(p.PublicPort)
+}
+
+func (p Port) String() string {
+	host, port := p.HostAddress()
+	return fmt.Sprintf("%v->%d/%s", net.JoinHostPort(host, port), p.PrivatePort, p.Type)
+}
+
+// LocalHost returns a host address that can be used to connect to a port
+// bound to ip. The unspecified (wildcard) addresses are replaced with the
+// loopback address of the same family.
+func LocalHost(ip string) string {
+	parsed := net.ParseIP(ip)
+	switch {
+	case ip == "":
+		return "127.0.0.1"
+	case parsed == nil:
+		return ip
+	case parsed.Equal(net.IPv4zero):
+		return "127.0.0.1"
+	case parsed.Equal(net.IPv6zero):
+		return net.IPv6loopback.String()
+	}
+	return ip
+}
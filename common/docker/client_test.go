@@ -0,0 +1,218 @@
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const containerListJSON = `[
+  {
+    "Id": "8dfafdbc3a40",
+    "Names": ["/beats_redis_1"],
+    "Image": "redis:3.2",
+    "State": "running",
+    "Labels": {
+      "com.docker.compose.project": "beats",
+      "com.docker.compose.service": "redis",
+      "com.docker.compose.container-number": "1"
+    },
+    "Ports": [
+      {"IP": "0.0.0.0", "PrivatePort": 6379, "PublicPort": 32768, "Type": "tcp"},
+      {"PrivatePort": 6380, "Type": "tcp"}
+    ]
+  }
+]`
+
+// fakeDaemon starts an HTTP server on a unix socket and returns the docker
+// host address for it.
+func fakeDaemon(t *testing.T, handler http.Handler) (string, func()) {
+	dir, err := ioutil.TempDir("", "bake-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	go http.Serve(l, handler)
+
+	return "unix://" + socket, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestClientProjectContainers(t *testing.T) {
+	var filters map[string][]string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v"+APIVersion+"/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+		w.Write([]byte(containerListJSON))
+	})
+
+	host, stop := fakeDaemon(t, mux)
+	defer stop()
+
+	c, err := NewClient(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	containers, err := c.ProjectContainers("beats")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{LabelProject + "=beats"}, filters["label"])
+	if assert.Len(t, containers, 1) {
+		container := containers[0]
+		assert.Equal(t, "redis", container.Service())
+		assert.Equal(t, 1, container.Number())
+
+		ports := container.PublishedPorts()
+		if assert.Len(t, ports, 1) {
+			host, port := ports[0].HostAddress()
+			assert.Equal(t, "127.0.0.1", host)
+			assert.Equal(t, "32768", port)
+			assert.Equal(t, 6379, ports[0].PrivatePort)
+		}
+	}
+}
+
+func TestClientProjectContainersDualStack(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v"+APIVersion+"/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{
+  "Id": "8dfafdbc3a40",
+  "Labels": {"com.docker.compose.service": "redis"},
+  "Ports": [
+    {"IP": "::", "PrivatePort": 6379, "PublicPort": 32769, "Type": "tcp"},
+    {"IP": "0.0.0.0", "PrivatePort": 6379, "PublicPort": 32768, "Type": "tcp"},
+    {"IP": "::", "PrivatePort": 6379, "PublicPort": 32770, "Type": "udp"}
+  ]
+}]`))
+	})
+
+	host, stop := fakeDaemon(t, mux)
+	defer stop()
+
+	c, err := NewClient(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	containers, err := c.ProjectContainers("beats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, containers, 1) {
+		assert.Equal(t, []Port{
+			{IP: "0.0.0.0", PrivatePort: 6379, PublicPort: 32768, Type: "tcp"},
+			{IP: "::", PrivatePort: 6379, PublicPort: 32770, Type: "udp"},
+		}, containers[0].PublishedPorts())
+	}
+}
+
+func TestClientAPIError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v"+APIVersion+"/_ping", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"message": "daemon is sad"}`))
+	})
+
+	host, stop := fakeDaemon(t, mux)
+	defer stop()
+
+	c, err := NewClient(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Ping()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "daemon is sad")
+	}
+}
+
+func TestClientImageID(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v"+APIVersion+"/images/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v"+APIVersion+"/images/example.com/crossbuild:1.0/json" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "no such image"}`))
+			return
+		}
+		w.Write([]byte(`{"Id": "sha256:4f1a"}`))
+	})
+
+	host, stop := fakeDaemon(t, mux)
+	defer stop()
+
+	c, err := NewClient(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := c.ImageID("example.com/crossbuild:1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:4f1a", id)
+
+	id, err = c.ImageID("missing:latest")
+	assert.NoError(t, err)
+	assert.Equal(t, "", id)
+}
+
+func TestClientImagePull(t *testing.T) {
+	var pulled []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v"+APIVersion+"/images/create", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		image := r.URL.Query().Get("fromImage") + " " + r.URL.Query().Get("tag")
+		pulled = append(pulled, image)
+		w.Write([]byte(`{"status": "Pulling from crossbuild"}` + "\n"))
+		if image == "missing latest" {
+			w.Write([]byte(`{"error": "manifest unknown"}` + "\n"))
+		}
+	})
+
+	host, stop := fakeDaemon(t, mux)
+	defer stop()
+
+	c, err := NewClient(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, c.ImagePull("localhost:5000/crossbuild:1.0"))
+	assert.NoError(t, c.ImagePull("crossbuild@sha256:4f1a"))
+	err = c.ImagePull("missing")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "manifest unknown")
+	}
+	assert.Equal(t, []string{"localhost:5000/crossbuild 1.0", "crossbuild sha256:4f1a", "missing latest"}, pulled)
+}
+
+func TestNewClientUnsupportedScheme(t *testing.T) {
+	_, err := NewClient("npipe:////./pipe/docker_engine")
+	assert.Error(t, err)
+}
+
+func TestLocalHost(t *testing.T) {
+	assert.Equal(t, "127.0.0.1", LocalHost("0.0.0.0"))
+	assert.Equal(t, "::1", LocalHost("::"))
+	assert.Equal(t, "192.168.1.10", LocalHost("192.168.1.10"))
+}
@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/andrewkroh/bake/common"
+	"github.com/pkg/errors"
+)
+
+// ComposeAuto is the Compose flavor name that selects automatic detection.
+const ComposeAuto = "auto"
+
+// Compose describes the docker-compose CLI that is available on the host. It
+// is either the standalone docker-compose binary or the `docker compose` CLI
+// plugin (Compose v2).
+type Compose struct {
+	// Command is the command and any leading arguments used to invoke
+	// Compose (e.g. ["docker", "compose"]).
+	Command []string
+
+	// Version is the version reported by Compose.
+	Version string
+}
+
+// V2 returns true if the Compose version is 2 or greater.
+func (c *Compose) V2() bool {
+	return !strings.HasPrefix(strings.TrimPrefix(c.Version, "v"), "1.")
+}
+
+// Cmd returns an exec.Cmd that runs Compose with the given arguments.
+func (c *Compose) Cmd(args ...string) *exec.Cmd {
+	return exec.Command(c.Command[0], c.args(args)...)
+}
+
+// CommonCmd is the same as Cmd but returns a common.Cmd.
+func (c *Compose) CommonCmd(args ...string) *common.Cmd {
+	return common.Command(c.Command[0], c.args(args)...)
+}
+
+func (c *Compose) args(args []string) []string {
+	all := make([]string, 0, len(c.Command)-1+len(args))
+	all = append(all, c.Command[1:]...)
+	return append(all, args...)
+}
+
+func (c *Compose) String() string {
+	return strings.Join(c.Command, " ") + " " + c.Version
+}
+
+// DetectCompose determines which Compose CLI is available. The flavor may be
+// ComposeAuto (or empty) to prefer the `docker compose` plugin and fall back
+// to the docker-compose binary, or it may be an explicit command such as
+// "docker-compose", "docker compose", or a path to a Compose binary.
+func DetectCompose(flavor string) (*Compose, error) {
+	var candidates [][]string
+	if flavor == "" || flavor == ComposeAuto {
+		candidates = [][]string{{"docker", "compose"}, {"docker-compose"}}
+	} else {
+		candidates = [][]string{strings.Fields(flavor)}
+	}
+
+	var lastErr error
+	for _, command := range candidates {
+		c := &Compose{Command: command}
+		version, err := common.RunCommand(c.Cmd("version", "--short"))
+		if err != nil {
+			log.WithError(err).WithField("compose", command).Debug("compose not available")
+			lastErr = err
+			continue
+		}
+
+		c.Version = strings.TrimSpace(string(version))
+		log.WithField("compose", c.Command).WithField("version", c.Version).Debug("detected compose")
+		return c, nil
+	}
+
+	return nil, errors.Wrap(lastErr, "neither 'docker compose' nor 'docker-compose' is available")
+}
+
+// ParsePortOutput parses the output of `compose port` and returns the host
+// and port. Compose v2 may report multiple addresses (e.g. IPv4 and IPv6) on
+// separate lines in which case the first is used.
+func ParsePortOutput(out []byte) (string, string, error) {
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// IPv6 addresses are not bracketed in some Compose versions
+		// (e.g. ":::32768").
+		i := strings.LastIndex(line, ":")
+		if i == -1 {
+			return "", "", errors.Errorf("invalid port mapping %q", line)
+		}
+		host := strings.TrimSuffix(strings.TrimPrefix(line[:i], "["), "]")
+		return LocalHost(host), line[i+1:], nil
+	}
+
+	return "", "", errors.New("empty port mapping")
+}
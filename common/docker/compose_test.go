@@ -0,0 +1,46 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComposeV2(t *testing.T) {
+	assert.False(t, (&Compose{Version: "1.29.2"}).V2())
+	assert.True(t, (&Compose{Version: "2.21.0"}).V2())
+	assert.True(t, (&Compose{Version: "v2.3.3"}).V2())
+}
+
+func TestComposeCmd(t *testing.T) {
+	c := &Compose{Command: []string{"docker", "compose"}}
+	cmd := c.Cmd("-f", "docker-compose.yml", "up")
+	assert.Equal(t, []string{"docker", "compose", "-f", "docker-compose.yml", "up"}, cmd.Args)
+
+	// The command must not be modified by building args.
+	c.Cmd("config")
+	assert.Equal(t, []string{"docker", "compose"}, c.Command)
+}
+
+func TestParsePortOutput(t *testing.T) {
+	testCases := []struct {
+		out, host, port string
+	}{
+		{"0.0.0.0:32768\n", "127.0.0.1", "32768"},
+		{"0.0.0.0:32768\n:::32768\n", "127.0.0.1", "32768"},
+		{":::32768\n", "::1", "32768"},
+		{"[::]:32768\n", "::1", "32768"},
+		{"192.168.1.5:9200", "192.168.1.5", "9200"},
+	}
+
+	for _, tc := range testCases {
+		host, port, err := ParsePortOutput([]byte(tc.out))
+		if assert.NoError(t, err, tc.out) {
+			assert.Equal(t, tc.host, host, tc.out)
+			assert.Equal(t, tc.port, port, tc.out)
+		}
+	}
+
+	_, _, err := ParsePortOutput([]byte("\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package docker
+
+import (
+	"os/exec"
+	"sort"
+)
+
+// RunOptions describes a container that runs a single command and is removed
+// when it exits.
+type RunOptions struct {
+	Image   string
+	User    string            // user[:group] to run as (default: the image's user).
+	Workdir string            // Working directory of the command.
+	Volumes map[string]string // Bind mounts from host paths to container paths (with an optional :ro suffix).
+	Env     []string          // Environment variables (KEY=value).
+	Command []string          // Command to run (default: the image's command).
+}
+
+// Args returns the arguments of `docker run` for the container.
+func (o RunOptions) Args() []string {
+	args := []string{"run", "--rm"}
+	if o.User != "" {
+		args = append(args, "--user", o.User)
+	}
+	if o.Workdir != "" {
+		args = append(args, "--workdir", o.Workdir)
+	}
+
+	hostPaths := make([]string, 0, len(o.Volumes))
+	for hostPath := range o.Volumes {
+		hostPaths = append(hostPaths, hostPath)
+	}
+	sort.Strings(hostPaths)
+	for _, hostPath := range hostPaths {
+		args = append(args, "--volume", hostPath+":"+o.Volumes[hostPath])
+	}
+
+	for _, env := range o.Env {
+		args = append(args, "--env", env)
+	}
+
+	args = append(args, o.Image)
+	return append(args, o.Command...)
+}
+
+// Cmd returns an exec.Cmd that runs the container using the docker CLI.
+func (o RunOptions) Cmd() *exec.Cmd {
+	return exec.Command("docker", o.Args()...)
+}
@@ -0,0 +1,22 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunOptionsArgs(t *testing.T) {
+	opts := RunOptions{
+		Image:   "crossbuild",
+		User:    "1000:1000",
+		Workdir: "/src",
+		Volumes: map[string]string{"/project": "/src", "/cache": "/gocache"},
+		Env:     []string{"GOOS=linux"},
+		Command: []string{"go", "build"},
+	}
+	assert.Equal(t, []string{"run", "--rm", "--user", "1000:1000", "--workdir", "/src",
+		"--volume", "/cache:/gocache", "--volume", "/project:/src",
+		"--env", "GOOS=linux", "crossbuild", "go", "build"}, opts.Args())
+	assert.Equal(t, []string{"run", "--rm", "alpine"}, RunOptions{Image: "alpine"}.Args())
+}
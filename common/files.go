@@ -0,0 +1,265 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// generatedCodeRegex matches the standard marker for generated Go files
+// (https://golang.org/s/generatedcode).
+var generatedCodeRegex = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// IsGenerated returns true if the Go source contains the generated code
+// marker before the package clause.
+func IsGenerated(src []byte) bool {
+	r := bufio.NewReader(bytes.NewReader(src))
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if generatedCodeRegex.MatchString(line) {
+			return true
+		}
+		if strings.HasPrefix(line, "package ") || err != nil {
+			return false
+		}
+	}
+}
+
+// isGeneratedFile returns true if the Go file contains the generated code
+// marker.
+func isGeneratedFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	// The marker must appear before the package clause so reading the start
+	// of the file is sufficient in practice.
+	buf := make([]byte, 16*1024)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	return IsGenerated(buf[:n]), nil
+}
+
+// FileFilter selects the files that bake operates on. By default it removes
+// files matching the Exclude patterns, files ignored by git, and generated Go
+// files.
+type FileFilter struct {
+	// Root is the directory that Exclude patterns are relative to. Defaults
+	// to the current directory.
+	Root string
+
+	// Exclude contains glob patterns of files to exclude. See MatchGlob.
+	Exclude []string
+
+	IncludeGenerated  bool // Keep Go files containing the generated code marker.
+	IncludeGitIgnored bool // Keep files that are ignored by git.
+}
+
+// Filter returns the files that are selected by the filter. Paths may be
+// absolute or relative to the current directory.
+func (f FileFilter) Filter(files []string) ([]string, error) {
+	root := f.Root
+	if root == "" {
+		root = "."
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, file := range files {
+		if len(f.Exclude) > 0 {
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				return nil, err
+			}
+			rel, err := filepath.Rel(root, abs)
+			if err != nil {
+				return nil, err
+			}
+			if matchAnyGlob(f.Exclude, filepath.ToSlash(rel)) {
+				log.WithField("file", file).Debug("file excluded by pattern")
+				continue
+			}
+		}
+		selected = append(selected, file)
+	}
+
+	if !f.IncludeGitIgnored && len(selected) > 0 {
+		ignored, err := GitIgnored(selected)
+		if err != nil {
+			return nil, err
+		}
+		if len(ignored) > 0 {
+			kept := selected[:0]
+			for _, file := range selected {
+				if !ignored[file] {
+					kept = append(kept, file)
+				}
+			}
+			selected = kept
+		}
+	}
+
+	if !f.IncludeGenerated {
+		kept := selected[:0]
+		for _, file := range selected {
+			if strings.HasSuffix(file, ".go") {
+				generated, err := isGeneratedFile(file)
+				if err != nil {
+					return nil, err
+				}
+				if generated {
+					log.WithField("file", file).Debug("skipping generated file")
+					continue
+				}
+			}
+			kept = append(kept, file)
+		}
+		selected = kept
+	}
+
+	return selected, nil
+}
+
+// GitIgnored returns the subset of files that are ignored by git. Files that
+// are tracked by git are never reported as ignored.
+func GitIgnored(files []string) (map[string]bool, error) {
+	cmd := exec.Command("git", "check-ignore", "-z", "--stdin")
+	cmd.Stdin = strings.NewReader(strings.Join(files, "\x00") + "\x00")
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		// Exit status 1 indicates that none of the files are ignored.
+		if exitErr, ok := err.(*exec.ExitError); !ok || stdout.Len() > 0 || stderr.Len() > 0 || !exitErr.Exited() {
+			return nil, errors.Errorf(`command failed (cmd="git check-ignore"): %v (stderr=%v)`, err, stderr.String())
+		}
+	}
+
+	ignored := map[string]bool{}
+	for _, f := range strings.Split(stdout.String(), "\x00") {
+		if f != "" {
+			ignored[f] = true
+		}
+	}
+	return ignored, nil
+}
+
+// MatchGlob reports whether the slash separated path matches the glob
+// pattern. In addition to the syntax supported by path.Match, "**" matches
+// any number of directories. A pattern without a slash is matched against
+// the base name of the path (like .gitignore).
+func MatchGlob(pattern, path string) bool {
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	return globRegex(pattern).MatchString(path)
+}
+
+func matchAnyGlob(patterns []string, path string) bool {
+	for _, p := range patterns {
+		if MatchGlob(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func globRegex(pattern string) *regexp.Regexp {
+	var buf bytes.Buffer
+	buf.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// "**/" matches zero or more directories.
+					i++
+					buf.WriteString("(?:.*/)?")
+				} else {
+					buf.WriteString(".*")
+				}
+			} else {
+				buf.WriteString("[^/]*")
+			}
+		case '?':
+			buf.WriteString("[^/]")
+		case '[':
+			if j := strings.IndexByte(pattern[i:], ']'); j != -1 {
+				class := pattern[i+1 : i+j]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				buf.WriteString("[" + class + "]")
+				i += j
+			} else {
+				buf.WriteString(`\[`)
+			}
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	// A pattern matching a directory matches everything beneath it.
+	buf.WriteString("(?:/.*)?$")
+
+	re, err := regexp.Compile(buf.String())
+	if err != nil {
+		return regexp.MustCompile(`^\b$`) // Matches nothing.
+	}
+	return re
+}
+
+// GoPackagesForFiles returns the import paths of the packages containing the
+// given Go files. Packages without any buildable Go files are omitted.
+func GoPackagesForFiles(files []string) ([]string, error) {
+	dirs := map[string]struct{}{}
+	for _, f := range files {
+		dir := filepath.Dir(f)
+		if !filepath.IsAbs(dir) {
+			dir = "." + string(filepath.Separator) + dir
+		}
+		dirs[dir] = struct{}{}
+	}
+	if len(dirs) == 0 {
+		return nil, nil
+	}
+
+	args := []string{"list", "-e", "-f", "{{if or .GoFiles .CgoFiles .TestGoFiles .XTestGoFiles}}{{.ImportPath}}{{end}}"}
+	var sorted []string
+	for d := range dirs {
+		sorted = append(sorted, d)
+	}
+	sort.Strings(sorted)
+	args = append(args, sorted...)
+
+	out, err := RunCommand(exec.Command("go", args...))
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []string
+	for _, p := range strings.Split(string(out), "\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			packages = append(packages, p)
+		}
+	}
+	return packages, nil
+}
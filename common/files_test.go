@@ -0,0 +1,90 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsGenerated(t *testing.T) {
+	assert.True(t, IsGenerated([]byte("// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage pb\n")))
+	assert.True(t, IsGenerated([]byte("// +build linux\r\n\r\n// Code generated by mkerrors. DO NOT EDIT.\r\n\r\npackage unix\r\n")))
+	assert.False(t, IsGenerated([]byte("package main\n\n// Code generated elsewhere, please edit.\n")))
+	assert.False(t, IsGenerated([]byte("// Code generated by hand.\npackage main\n")))
+}
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"*.pb.go", "foo.pb.go", true},
+		{"*.pb.go", "a/b/foo.pb.go", true},
+		{"*.pb.go", "a/b/foo.go", false},
+		{"testdata", "a/testdata/x.go", true},
+		{"a/*.go", "a/x.go", true},
+		{"a/*.go", "a/b/x.go", false},
+		{"a/**/*.go", "a/x.go", true},
+		{"a/**/*.go", "a/b/c/x.go", true},
+		{"a/**", "a/b/c/x.go", true},
+		{"a/**", "b/a/x.go", false},
+		{"**/zz_*.go", "pkg/zz_generated.go", true},
+		{"x?.go", "x1.go", true},
+		{"x[0-9].go", "x1.go", true},
+		{"x[!0-9].go", "x1.go", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.match, MatchGlob(c.pattern, c.path), "pattern=%v path=%v", c.pattern, c.path)
+	}
+}
+
+func TestFileFilter(t *testing.T) {
+	dir, cleanup := gitRepo(t)
+	defer cleanup()
+
+	git(t, "init", "-q")
+	writeFile(t, ".gitignore", "build/\n")
+	writeFile(t, "a.go", "package a\n")
+	writeFile(t, "gen.go", "// Code generated by stringer. DO NOT EDIT.\n\npackage a\n")
+	writeFile(t, "a.pb.go", "package a\n")
+	writeFile(t, "build/b.go", "package b\n")
+	writeFile(t, "README", "// Code generated by nothing. DO NOT EDIT.\n")
+
+	files := []string{"a.go", "gen.go", "a.pb.go", "build/b.go", "README"}
+
+	selected, err := FileFilter{Root: dir, Exclude: []string{"*.pb.go"}}.Filter(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"a.go", "README"}, selected)
+
+	selected, err = FileFilter{Root: dir, IncludeGenerated: true, IncludeGitIgnored: true}.Filter(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, files, selected)
+}
+
+func TestGitIgnoredTracked(t *testing.T) {
+	_, cleanup := gitRepo(t)
+	defer cleanup()
+
+	git(t, "init", "-q")
+	writeFile(t, "build/tracked.go", "package build\n")
+	git(t, "add", ".")
+	writeFile(t, ".gitignore", "build/\n")
+	writeFile(t, "build/untracked.go", "package build\n")
+
+	ignored, err := GitIgnored([]string{"build/tracked.go", "build/untracked.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]bool{"build/untracked.go": true}, ignored)
+
+	ignored, err = GitIgnored([]string{"build/tracked.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, ignored)
+}
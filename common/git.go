@@ -0,0 +1,167 @@
+package common
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ChangedFiles returns the files in and below the current directory that have
+// been added, copied, modified, or renamed since the merge base of ref and
+// HEAD. This includes staged and unstaged changes as well as untracked files
+// that are not ignored. Deleted files are not included. The paths are
+// relative to the current directory.
+func ChangedFiles(ref string) ([]string, error) {
+	base, err := RunCommand(exec.Command("git", "merge-base", ref, "HEAD"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find merge base with %v", ref)
+	}
+
+	diff, err := RunCommand(exec.Command("git", "diff", "--name-only", "--relative",
+		"--diff-filter=ACMR", "-z", strings.TrimSpace(string(base))))
+	if err != nil {
+		return nil, err
+	}
+
+	untracked, err := RunCommand(exec.Command("git", "ls-files", "--others", "--exclude-standard", "-z"))
+	if err != nil {
+		return nil, err
+	}
+
+	unique := map[string]struct{}{}
+	for _, out := range [][]byte{diff, untracked} {
+		for _, f := range strings.Split(string(out), "\x00") {
+			if f != "" {
+				unique[filepath.FromSlash(f)] = struct{}{}
+			}
+		}
+	}
+
+	files := make([]string, 0, len(unique))
+	for f := range unique {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	log.WithField("ref", ref).WithField("files", files).Debug("found changed files")
+	return files, nil
+}
+
+// ChangedGoFiles returns the non-vendor Go files that have changed since ref.
+// See ChangedFiles.
+func ChangedGoFiles(ref string) ([]string, error) {
+	changed, err := ChangedFiles(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, f := range changed {
+		if !strings.HasSuffix(f, ".go") || isVendorPath(f) {
+			continue
+		}
+
+		if info, err := os.Stat(f); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// GitHooksDir returns the absolute path to the directory containing the git
+// hooks for the repository at root. It honors core.hooksPath and resolves the
+// common git directory so that worktrees share the hooks of the main
+// repository.
+func GitHooksDir(root string) (string, error) {
+	cmd := exec.Command("git", "config", "core.hooksPath")
+	cmd.Dir = root
+	if out, err := cmd.Output(); err == nil {
+		if hooksPath := strings.TrimSpace(string(out)); hooksPath != "" {
+			if !filepath.IsAbs(hooksPath) {
+				hooksPath = filepath.Join(root, hooksPath)
+			}
+			return filepath.Clean(hooksPath), nil
+		}
+	}
+
+	cmd = exec.Command("git", "rev-parse", "--git-common-dir")
+	cmd.Dir = root
+	out, err := RunCommand(cmd)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to find git directory")
+	}
+
+	gitDir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(root, gitDir)
+	}
+	return filepath.Join(filepath.Clean(gitDir), "hooks"), nil
+}
+
+// GitCommit returns the commit hash of HEAD for the repository at root and
+// whether the working tree has uncommitted changes (including untracked files
+// that are not ignored).
+func GitCommit(root string) (string, bool, error) {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = root
+	out, err := RunCommand(cmd)
+	if err != nil {
+		return "", false, errors.Wrap(err, "failed to get the commit hash")
+	}
+	commit := strings.TrimSpace(string(out))
+
+	cmd = exec.Command("git", "status", "--porcelain")
+	cmd.Dir = root
+	status, err := RunCommand(cmd)
+	if err != nil {
+		return "", false, errors.Wrap(err, "failed to get the working tree status")
+	}
+	return commit, len(bytes.TrimSpace(status)) > 0, nil
+}
+
+// GitCommitTime returns the committer time of HEAD for the repository at
+// root.
+func GitCommitTime(root string) (time.Time, error) {
+	cmd := exec.Command("git", "log", "-1", "--format=%ct", "HEAD")
+	cmd.Dir = root
+	out, err := RunCommand(cmd)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to get the commit time")
+	}
+	sec, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to parse the commit time")
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// GitTag returns the most recent tag reachable from HEAD for the repository
+// at root (see git describe) or an empty string if there is none.
+func GitTag(root string) (string, error) {
+	cmd := exec.Command("git", "tag", "--merged", "HEAD")
+	cmd.Dir = root
+	tags, err := RunCommand(cmd)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list tags")
+	}
+	if len(bytes.TrimSpace(tags)) == 0 {
+		return "", nil
+	}
+
+	cmd = exec.Command("git", "describe", "--tags", "--abbrev=0")
+	cmd.Dir = root
+	out, err := RunCommand(cmd)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to describe HEAD")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
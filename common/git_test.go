@@ -0,0 +1,154 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gitRepo creates a git repository in a temporary directory and changes the
+// working directory to it. The returned function restores the working
+// directory and removes the repository.
+func gitRepo(t *testing.T) (string, func()) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "bake-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, func() {
+		os.Chdir(cwd)
+		os.RemoveAll(dir)
+	}
+}
+
+func git(t *testing.T, args ...string) {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=bake", "-c", "user.email=bake@example.com"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChangedGoFiles(t *testing.T) {
+	_, cleanup := gitRepo(t)
+	defer cleanup()
+
+	git(t, "init", "-q")
+	writeFile(t, "a.go", "package a\n")
+	writeFile(t, "b.go", "package a\n")
+	writeFile(t, "deleted.go", "package a\n")
+	git(t, "add", "-A")
+	git(t, "commit", "-q", "-m", "base")
+	git(t, "tag", "base")
+
+	writeFile(t, "a.go", "package a\n\n// committed\n")
+	git(t, "commit", "-q", "-am", "change a")
+
+	writeFile(t, filepath.Join("sub", "staged.go"), "package sub\n")
+	git(t, "add", "sub")
+	writeFile(t, "b.go", "package a\n\n// unstaged\n")
+	writeFile(t, "untracked.go", "package a\n")
+	writeFile(t, filepath.Join("vendor", "lib", "lib.go"), "package lib\n")
+	writeFile(t, "README.md", "readme\n")
+	os.Remove("deleted.go")
+
+	files, err := ChangedGoFiles("base")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"a.go", "b.go", filepath.Join("sub", "staged.go"), "untracked.go"}, files)
+}
+
+func TestGitHooksDir(t *testing.T) {
+	dir, cleanup := gitRepo(t)
+	defer cleanup()
+
+	// Resolve symlinks (e.g. /tmp on macOS) so paths can be compared.
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	git(t, "init", "-q")
+	hooks, err := GitHooksDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, filepath.Join(dir, ".git", "hooks"), hooks)
+
+	git(t, "config", "core.hooksPath", ".githooks")
+	hooks, err = GitHooksDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, filepath.Join(dir, ".githooks"), hooks)
+}
+
+func TestGitCommitAndTag(t *testing.T) {
+	dir, cleanup := gitRepo(t)
+	defer cleanup()
+
+	git(t, "init", "-q")
+	writeFile(t, "main.go", "package main\n")
+	git(t, "add", "main.go")
+	git(t, "commit", "-q", "-m", "initial")
+
+	commit, dirty, err := GitCommit(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, commit, 40)
+	assert.False(t, dirty)
+
+	commitTime, err := GitCommitTime(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.WithinDuration(t, time.Now(), commitTime, time.Minute)
+
+	tag, err := GitTag(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "", tag)
+
+	git(t, "tag", "v1.2.0")
+	writeFile(t, "main.go", "package main\n\nfunc main() {}\n")
+	_, dirty, err = GitCommit(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, dirty)
+
+	tag, err = GitTag(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "v1.2.0", tag)
+}
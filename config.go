@@ -0,0 +1,465 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andrewkroh/bake/common"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// projectConfigFile is the name of the optional project configuration file
+// that is read from the project root.
+const projectConfigFile = ".bake.yml"
+
+// projectConfig is the configuration loaded from the project's .bake.yml file.
+// It is populated before any command is run.
+var projectConfig = &ProjectConfig{}
+
+// ProjectConfig contains project specific settings for bake.
+type ProjectConfig struct {
+	Check   CheckConfig   `yaml:"check"`
+	Imports ImportsConfig `yaml:"imports"`
+	Headers HeadersConfig `yaml:"headers"`
+	Files   FilesConfig   `yaml:"files"`
+	Vet     VetConfig     `yaml:"vet"`
+	Beat    BeatConfig    `yaml:"beat"`
+	Fields  FieldsConfig  `yaml:"fields"`
+	Update  UpdateConfig  `yaml:"update"`
+	Config  SnippetConfig `yaml:"config"`
+	Notice  NoticeConfig  `yaml:"notice"`
+	Build   BuildConfig   `yaml:"build"`
+	Package PackageConfig `yaml:"package"`
+}
+
+// NoticeConfig overrides the defaults used when generating the NOTICE file.
+type NoticeConfig struct {
+	Beat      string `yaml:"beat"`      // Name of the Beat. Defaults to Elastic Beats.
+	Copyright string `yaml:"copyright"` // Copyright owner. Defaults to Elasticsearch BV.
+	Year      int    `yaml:"year"`      // Copyright begin year. Defaults to 2014.
+}
+
+// BeatConfig describes the Beat that is built by the project.
+type BeatConfig struct {
+	// Name is the name of the Beat (e.g. metricbeat). Defaults to the name
+	// of the project root directory.
+	Name string `yaml:"name"`
+
+	// IndexPrefix is the prefix of the Beat's Elasticsearch indices.
+	// Defaults to the name of the Beat.
+	IndexPrefix string `yaml:"index_prefix"`
+}
+
+// BeatName returns the name of the Beat.
+func (c BeatConfig) BeatName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return filepath.Base(ProjectRootAbs)
+}
+
+// Index returns the prefix of the Beat's Elasticsearch indices.
+func (c BeatConfig) Index() string {
+	if c.IndexPrefix != "" {
+		return c.IndexPrefix
+	}
+	return c.BeatName()
+}
+
+// BeatTitle returns the name of the Beat with the first letter capitalized
+// (e.g. Metricbeat).
+func (c BeatConfig) BeatTitle() string {
+	name := c.BeatName()
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// FieldsConfig describes the fields.yml files of a Beat.
+type FieldsConfig struct {
+	// Files contains glob patterns (relative to the project root) of the
+	// fields.yml files in the order that they are combined. Defaults to
+	// _meta/fields*.yml followed by **/_meta/fields*.yml.
+	Files []string `yaml:"files"`
+
+	// Docs is the path of the generated field documentation relative to the
+	// project root. Defaults to docs/fields.asciidoc.
+	Docs string `yaml:"docs"`
+
+	// Combined is the path of the combined fields.yml relative to the
+	// project root. Defaults to fields.yml.
+	Combined string `yaml:"combined"`
+
+	// Go is the path of the Go file that embeds the combined fields.yml
+	// relative to the project root. Defaults to include/fields.go.
+	Go string `yaml:"go"`
+
+	// Template is the path of the generated Elasticsearch index template
+	// relative to the project root. Defaults to <beat>.template.json.
+	Template string `yaml:"template"`
+
+	// Kibana is the path of the generated Kibana index pattern relative to
+	// the project root. Defaults to
+	// _meta/kibana/default/index-pattern/<beat>.json.
+	Kibana string `yaml:"kibana"`
+}
+
+// Patterns returns the glob patterns of the fields.yml files.
+func (c FieldsConfig) Patterns() []string {
+	if len(c.Files) > 0 {
+		return c.Files
+	}
+	return defaultFieldsFiles
+}
+
+// DocsPath returns the path of the generated field documentation relative to
+// the current directory.
+func (c FieldsConfig) DocsPath() string {
+	return projectPath(c.Docs, "docs/fields.asciidoc")
+}
+
+// CombinedPath returns the path of the combined fields.yml relative to the
+// current directory.
+func (c FieldsConfig) CombinedPath() string {
+	return projectPath(c.Combined, "fields.yml")
+}
+
+// GoPath returns the path of the fields.go asset relative to the current
+// directory.
+func (c FieldsConfig) GoPath() string {
+	return projectPath(c.Go, "include/fields.go")
+}
+
+// TemplatePath returns the path of the Elasticsearch index template relative
+// to the current directory.
+func (c FieldsConfig) TemplatePath(beat string) string {
+	return projectPath(c.Template, beat+".template.json")
+}
+
+// KibanaPath returns the path of the Kibana index pattern relative to the
+// current directory.
+func (c FieldsConfig) KibanaPath(beat string) string {
+	return projectPath(c.Kibana, "_meta/kibana/default/index-pattern/"+beat+".json")
+}
+
+// SnippetConfig describes the snippets that bake config concatenates into
+// <beat>.yml and <beat>.reference.yml.
+type SnippetConfig struct {
+	// Short and Reference contain glob patterns (relative to the project
+	// root) of the snippets. Snippets are ordered by the first pattern that
+	// they match and then by path, so listing a file before a glob that
+	// matches it moves it to the front.
+	Short     []string `yaml:"short"`
+	Reference []string `yaml:"reference"`
+
+	// Libbeat is the libbeat directory whose _meta/config.yml or
+	// _meta/config.reference.yml is appended to the config. Defaults to the
+	// vendored libbeat or ../libbeat when they exist.
+	Libbeat string `yaml:"libbeat"`
+
+	// GOOS is the operating system of the committed config files. Defaults
+	// to linux.
+	GOOS string `yaml:"goos"`
+}
+
+// Patterns returns the glob patterns of the short or reference snippets.
+func (c SnippetConfig) Patterns(reference bool) []string {
+	if reference {
+		if len(c.Reference) > 0 {
+			return c.Reference
+		}
+		return []string{"_meta/beat.reference.yml", "module/*/_meta/config.reference.yml"}
+	}
+	if len(c.Short) > 0 {
+		return c.Short
+	}
+	return []string{"_meta/beat.yml", "module/*/_meta/config.yml"}
+}
+
+// LibbeatDir returns the libbeat directory relative to the current directory
+// or an empty string if there is none.
+func (c SnippetConfig) LibbeatDir() string {
+	if c.Libbeat != "" {
+		return projectPath(c.Libbeat, "")
+	}
+	for _, dir := range []string{"vendor/github.com/elastic/beats/libbeat", "../libbeat"} {
+		path := projectPath(dir, "")
+		if info, err := os.Stat(filepath.Join(path, "_meta")); err == nil && info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// OS returns the operating system of the committed config files.
+func (c SnippetConfig) OS() string {
+	if c.GOOS != "" {
+		return c.GOOS
+	}
+	return "linux"
+}
+
+// UpdateConfig controls the artifacts generated by bake update.
+type UpdateConfig struct {
+	// Disabled lists artifacts that are not updated unless they are
+	// specified on the command line (e.g. kibana).
+	Disabled []string `yaml:"disabled"`
+}
+
+// defaultPlatforms are the GOOS/GOARCH pairs built by bake crosscompile.
+var defaultPlatforms = []string{
+	"linux/amd64",
+	"linux/386",
+	"linux/arm64",
+	"darwin/amd64",
+	"windows/amd64",
+	"windows/386",
+}
+
+// BuildConfig describes the binaries built by bake crosscompile.
+type BuildConfig struct {
+	// Platforms lists the GOOS/GOARCH pairs to build. Defaults to
+	// defaultPlatforms.
+	Platforms []string `yaml:"platforms"`
+
+	// Output is the directory of the binaries relative to the project root.
+	// Defaults to build/bin.
+	Output string `yaml:"output"`
+
+	// Cache is the directory of the build cache relative to the project
+	// root. Defaults to build/cache.
+	Cache string `yaml:"cache"`
+
+	// VersionFile is a Go file (relative to the project root) that defines
+	// the version in a string constant or variable whose name contains
+	// "version" (e.g. const defaultBeatVersion = "6.0.0"). If empty then the
+	// version is the most recent git tag without its "v" prefix.
+	VersionFile string `yaml:"version_file"`
+
+	// Vars are the Go variables (<import path>.<name>) that are set to the
+	// build metadata with -ldflags -X.
+	Vars BuildVars `yaml:"vars"`
+
+	// CGO configures the cross-compiler images used by
+	// bake crosscompile --cgo.
+	CGO CGOConfig `yaml:"cgo"`
+}
+
+// CGOConfig configures builds with CGO enabled. They run go build in a
+// cross-compiler Docker image for each platform.
+type CGOConfig struct {
+	// Images maps GOOS/GOARCH to the image that builds the platform. The
+	// image must contain Go and a C cross-compiler for the platform.
+	Images map[string]string `yaml:"images"`
+
+	// Env maps GOOS/GOARCH to additional environment variables (KEY=value)
+	// for go build in the image (e.g. CC=aarch64-linux-gnu-gcc).
+	Env map[string][]string `yaml:"env"`
+}
+
+// BuildVars names the Go variables that receive the build metadata. Empty
+// names are not set.
+type BuildVars struct {
+	Version   string `yaml:"version"`    // Version from the version file or tag.
+	Commit    string `yaml:"commit"`     // Commit hash of HEAD.
+	Dirty     string `yaml:"dirty"`      // "true" if there are uncommitted changes.
+	BuildTime string `yaml:"build_time"` // UTC build time in RFC 3339 format.
+}
+
+// PlatformList returns the GOOS/GOARCH pairs to build.
+func (c BuildConfig) PlatformList() []string {
+	if len(c.Platforms) > 0 {
+		return c.Platforms
+	}
+	return defaultPlatforms
+}
+
+// OutputDir returns the directory of the binaries relative to the current
+// directory.
+func (c BuildConfig) OutputDir() string {
+	return projectPath(c.Output, "build/bin")
+}
+
+// CacheDir returns the directory of the build cache relative to the current
+// directory.
+func (c BuildConfig) CacheDir() string {
+	return projectPath(c.Cache, "build/cache")
+}
+
+// PackageConfig describes the packages created by bake package.
+type PackageConfig struct {
+	// Output is the directory of the packages relative to the project root.
+	// Defaults to build/distributions.
+	Output string `yaml:"output"`
+
+	// Version of the packages. It can be overridden with --version.
+	Version string `yaml:"version"`
+
+	// Metadata of the deb and rpm packages. The vendor and maintainer
+	// default to the NOTICE copyright owner and the license to ASL 2.0.
+	Vendor      string `yaml:"vendor"`
+	Maintainer  string `yaml:"maintainer"`
+	Homepage    string `yaml:"homepage"`
+	Description string `yaml:"description"`
+	License     string `yaml:"license"`
+}
+
+// OutputDir returns the directory of the packages relative to the current
+// directory.
+func (c PackageConfig) OutputDir() string {
+	return projectPath(c.Output, "build/distributions")
+}
+
+// projectPath returns the path (or the default if path is empty) relative to
+// the current directory. Relative paths are relative to the project root.
+func projectPath(path, defaultPath string) string {
+	if path == "" {
+		path = defaultPath
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(ProjectRootRel, filepath.FromSlash(path))
+}
+
+// VetConfig selects the analyzers run by the vet check (see vetAnalyzers).
+type VetConfig struct {
+	// Enabled lists the analyzers to run. If empty then all of the
+	// analyzers except the opt-in analyzers (shadow) are run.
+	Enabled []string `yaml:"enabled"`
+
+	// Disabled lists analyzers that are not run.
+	Disabled []string `yaml:"disabled"`
+}
+
+// Flags returns the multichecker flags that select the configured analyzers.
+func (c VetConfig) Flags() ([]string, error) {
+	var flags []string
+	// When any analyzer is explicitly enabled only those analyzers are run.
+	for _, name := range c.Enabled {
+		flags = append(flags, "-"+name+"=true")
+	}
+	for _, name := range c.Disabled {
+		flags = append(flags, "-"+name+"=false")
+	}
+	if len(c.Enabled) == 0 {
+		for _, name := range vetOptInAnalyzers {
+			flags = append(flags, "-"+name+"=false")
+		}
+	}
+
+	for _, name := range append(c.Enabled, c.Disabled...) {
+		if findAnalyzer(name) == nil {
+			return nil, errors.Errorf("unknown vet analyzer %v", name)
+		}
+	}
+	return flags, nil
+}
+
+// FilesConfig controls which files are examined by fmt, check, and notice.
+// Generated Go files and files ignored by git are skipped unless included
+// explicitly.
+type FilesConfig struct {
+	// Exclude contains glob patterns relative to the project root. "**"
+	// matches any number of directories and a pattern without a slash
+	// matches the file name in any directory (e.g. "*.pb.go").
+	Exclude []string `yaml:"exclude"`
+
+	IncludeGenerated  bool `yaml:"include_generated"`
+	IncludeGitIgnored bool `yaml:"include_gitignored"`
+}
+
+// Filter returns the file filter described by the configuration.
+func (c FilesConfig) Filter() common.FileFilter {
+	return common.FileFilter{
+		Root:              ProjectRootAbs,
+		Exclude:           c.Exclude,
+		IncludeGenerated:  c.IncludeGenerated,
+		IncludeGitIgnored: c.IncludeGitIgnored,
+	}
+}
+
+// CheckConfig controls which checks are run by default.
+type CheckConfig struct {
+	// Enabled lists the checks to run when none are specified on the command
+	// line. If empty then all registered checks are run.
+	Enabled []string `yaml:"enabled"`
+
+	// Disabled lists checks that are not run unless they are specified on the
+	// command line.
+	Disabled []string `yaml:"disabled"`
+}
+
+// ImportsConfig controls how imports are grouped.
+type ImportsConfig struct {
+	// Local is a comma separated list of import path prefixes that are put
+	// in their own group after third-party imports
+	// (e.g. github.com/elastic/beats).
+	Local string `yaml:"local"`
+}
+
+// LocalPrefixes returns the local import path prefixes.
+func (c ImportsConfig) LocalPrefixes() []string {
+	var prefixes []string
+	for _, p := range strings.Split(c.Local, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes
+}
+
+// HeadersConfig describes the license header that Go files must begin with.
+// The header is given inline by Template or read from File (relative to the
+// project root). It may use {{.Year}} for the copyright year.
+type HeadersConfig struct {
+	Template string `yaml:"template"`
+	File     string `yaml:"file"`
+}
+
+// LicenseHeader returns the configured license header or nil if no header is
+// configured.
+func (c HeadersConfig) LicenseHeader() (*licenseHeader, error) {
+	text := c.Template
+	if c.File != "" {
+		path := c.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(ProjectRootAbs, path)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read header template")
+		}
+		text = string(data)
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	return newLicenseHeader(text)
+}
+
+// loadProjectConfig reads the project configuration file. A missing file is
+// not an error and results in the default configuration.
+func loadProjectConfig(path string) (*ProjectConfig, error) {
+	config := &ProjectConfig{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, errors.Wrap(err, "failed to read project config")
+	}
+
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse project config %v", path)
+	}
+
+	return config, nil
+}
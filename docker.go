@@ -3,177 +3,559 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/andrewkroh/bake/common"
+	"github.com/andrewkroh/bake/common/docker"
 	"github.com/pkg/errors"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"gopkg.in/yaml.v2"
 )
 
 const (
-	dockerComposeCmd = "docker-compose"
+	// serviceStartTimeout is the maximum amount of time to wait for the
+	// containers of all services to be created and have their ports published.
+	serviceStartTimeout = 2 * time.Minute
 )
 
 var dockerLog = logrus.WithField("package", "main").WithField("cmd", "docker")
 
 func registerDockerCommand(app *kingpin.Application) {
-	cmd := &DockerCommand{}
-	docker := app.Command("docker", "Start test services powered by Docker "+
-		"and open a shell on the host where environment variables point to services.").Action(cmd.Run)
-	docker.Flag("project", "Specify an alternate project name (default: directory name)").Short('p').StringVar(&cmd.Project)
-	docker.Flag("file", "Specify an alternate compose file (default: docker-compose.yml)").Short('f').Default("docker-compose.yml").StringsVar(&cmd.Files)
-	docker.Flag("log", "Specify log output file").Short('o').StringVar(&cmd.Log)
-	docker.Arg("script", "Script to run").StringVar(&cmd.Script)
+	cmd := &DockerCommand{Scale: map[string]string{}}
+	dockerCmd := app.Command("docker", "Start test services powered by Docker "+
+		"and open a shell on the host where environment variables point to services.")
+	dockerCmd.Flag("project", "Specify an alternate project name (default: directory name)").Short('p').StringVar(&cmd.Project)
+	dockerCmd.Flag("file", "Specify an alternate compose file (default: docker-compose.yml)").Short('f').Default("docker-compose.yml").StringsVar(&cmd.Files)
+	dockerCmd.Flag("compose", "Compose command to use: auto, docker-compose, 'docker compose', or a path to a binary").Default(docker.ComposeAuto).Envar("BAKE_DOCKER_COMPOSE").StringVar(&cmd.Compose)
+	dockerCmd.Flag("profile", "Enable a compose profile").StringsVar(&cmd.Profiles)
+	dockerCmd.Flag("save-logs", "Write the logs of each service to a separate file in the log directory").BoolVar(&cmd.SaveLogs)
+	dockerCmd.Flag("log-dir", "Directory where service logs are written when --save-logs is used").Default(filepath.Join(ProjectRootRel, "build", "docker-logs")).StringVar(&cmd.LogDir)
+
+	up := dockerCmd.Command("up", "Start the services and open a shell (default).").Default().Action(cmd.Run)
+	up.Flag("log", "Specify log output file").Short('o').StringVar(&cmd.Log)
+	up.Flag("scale", "Scale a service to a number of instances (e.g. --scale redis=2)").PlaceHolder("SERVICE=NUM").StringMapVar(&cmd.Scale)
+	up.Arg("services", "Services to start (default: all services). A command to run "+
+		"instead of an interactive shell can be given after --.").StringsVar(&cmd.Services)
+
+	logs := dockerCmd.Command("logs", "Stream the logs of running services with each line prefixed by the service name.").Action(cmd.Logs)
+	logs.Flag("follow", "Follow log output").Default("true").BoolVar(&cmd.Follow)
+	logs.Arg("services", "Services whose logs are shown (default: all services).").StringsVar(&cmd.Services)
 }
 
 type DockerCommand struct {
-	Project string
-	Files   []string
-	Log     string
-	Script  string
+	Project  string
+	Files    []string
+	Log      string
+	Compose  string
+	Profiles []string
+	Scale    map[string]string
+	Services []string
+	Command  []string
+	SaveLogs bool
+	LogDir   string
+	Follow   bool
+
+	compose *docker.Compose
+	scale   map[string]int // Number of instances by service name.
+	args    []string       // Common compose arguments (project, files, profiles).
+	config  Config
+	project string
 }
 
-func (c *DockerCommand) Run(ctx *kingpin.ParseContext) error {
-	var args []string
+// setup detects the compose CLI and reads the compose config.
+func (c *DockerCommand) setup() error {
+	c.scale = map[string]int{}
+	for service, num := range c.Scale {
+		n, err := strconv.Atoi(num)
+		if err != nil || n < 1 {
+			return errors.Errorf("invalid scale for service %v: %v", service, num)
+		}
+		c.scale[service] = n
+	}
+
+	var err error
+	c.compose, err = docker.DetectCompose(c.Compose)
+	if err != nil {
+		return err
+	}
+	dockerLog.WithField("compose", c.compose.String()).Debug("Using compose")
+
+	c.args = nil
 	if c.Project != "" {
-		args = append(args, []string{"-p", c.Project}...)
+		c.args = append(c.args, []string{"-p", c.Project}...)
 	}
 	for _, f := range c.Files {
-		args = append(args, []string{"-f", f}...)
+		c.args = append(c.args, []string{"-f", f}...)
+	}
+	for _, p := range c.Profiles {
+		c.args = append(c.args, []string{"--profile", p}...)
 	}
 
-	configYAML, err := common.RunCommand(exec.Command(dockerComposeCmd, append(args, "config")...))
+	configYAML, err := common.RunCommand(c.compose.Cmd(append(c.args, "config")...))
 	if err != nil {
 		return errors.Wrap(err, "failed to get docker-compose config")
 	}
 
-	cmd, err := c.dockerComposeUp(args)
+	c.config = Config{}
+	if err := yaml.Unmarshal(configYAML, &c.config); err != nil {
+		return errors.Wrap(err, "failed to parse docker-compose config")
+	}
+
+	for _, name := range c.Services {
+		if _, found := c.config.Services[name]; !found {
+			return errors.Errorf("service %v is not defined in the compose files (or its profile is not enabled)", name)
+		}
+	}
+
+	c.project = c.projectName(c.config)
+	return nil
+}
+
+func (c *DockerCommand) Run(ctx *kingpin.ParseContext) error {
+	c.Command = PassthroughArgs
+	if err := c.setup(); err != nil {
+		return err
+	}
+
+	stop, err := c.dockerComposeUp()
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	env, err := c.getServiceEnv(c.project, c.args, c.config)
 	if err != nil {
 		return err
 	}
-	defer cmd.SendCtrlCSignal()
 
-	env, err := getServicePorts(args, configYAML)
+	env["BAKE_DOCKER"] = "1"
+	env["BAKE_DOCKER_PROJECT"] = c.project
+
+	if len(c.Command) > 0 {
+		return run(env, c.Command[0], c.Command[1:]...)
+	}
+
+	// Only modify the prompt if it was exported by the user's environment.
+	if ps1, found := os.LookupEnv("PS1"); found {
+		env["PS1"] = fmt.Sprintf("(bake:%s) %s", c.project, ps1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Entering bake docker shell for project %v. "+
+		"Exit the shell to stop the services.\n", c.project)
+	return run(env, userShell())
+}
+
+// Logs streams the logs of the services to stdout. Each line is prefixed with
+// the name of the service instance.
+func (c *DockerCommand) Logs(ctx *kingpin.ParseContext) error {
+	if err := c.setup(); err != nil {
+		return err
+	}
+
+	dir := ""
+	if c.SaveLogs {
+		dir = c.LogDir
+	}
+	w, err := newServiceLogWriter(c.project, os.Stdout, logrus.IsTerminal(os.Stdout), dir)
 	if err != nil {
 		return err
 	}
+	defer w.Close()
+
+	args := append(c.args[:len(c.args):len(c.args)], "logs", "--no-color")
+	if c.Follow {
+		args = append(args, "--follow")
+	}
+	args = append(args, c.Services...)
+
+	cmd := c.compose.Cmd(args...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	return cmd.Run()
+}
+
+// projectName returns the name that docker-compose uses for the project.
+// Compose v2 reports the name in its config output. Otherwise if no name was
+// specified then docker-compose uses the name of the directory containing the
+// first compose file.
+func (c *DockerCommand) projectName(config Config) string {
+	if config.Name != "" {
+		return config.Name
+	}
+	if c.Project != "" {
+		return normalizeProjectName(c.Project, c.v2())
+	}
+
+	dir := "."
+	if len(c.Files) > 0 {
+		dir = filepath.Dir(c.Files[0])
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	return normalizeProjectName(filepath.Base(dir), c.v2())
+}
+
+// v2 returns true if the detected Compose CLI is v2 or greater.
+func (c *DockerCommand) v2() bool {
+	return c.compose != nil && c.compose.V2()
+}
 
-	return shell(env)
+var (
+	nonAlphaNumRegex        = regexp.MustCompile(`[^a-z0-9]`)
+	invalidProjectNameRegex = regexp.MustCompile(`[^a-z0-9_-]`)
+)
+
+// normalizeProjectName normalizes a project name in the same manner as
+// docker-compose by lowercasing it. Compose v1 removes all non-alphanumeric
+// characters. Compose v2 keeps dashes and underscores but the name must
+// begin with a letter or digit.
+func normalizeProjectName(name string, v2 bool) string {
+	name = strings.ToLower(name)
+	if !v2 {
+		return nonAlphaNumRegex.ReplaceAllString(name, "")
+	}
+	return strings.TrimLeft(invalidProjectNameRegex.ReplaceAllString(name, ""), "_-")
 }
 
-func (c *DockerCommand) dockerComposeUp(args []string) (*common.Cmd, error) {
-	cmd := common.Command(dockerComposeCmd, append(args, "up")...)
-	cmd.Stdout = ioutil.Discard
+// dockerComposeUp starts the services in the background. Compose's output is
+// written to the --log file and, if --save-logs is enabled, to a file per
+// service. The returned function stops the services and waits for compose to
+// exit.
+func (c *DockerCommand) dockerComposeUp() (func(), error) {
+	args := append(c.args[:len(c.args):len(c.args)], "up", "--no-color")
+	for service, n := range c.scale {
+		args = append(args, "--scale", fmt.Sprintf("%s=%d", service, n))
+	}
+	args = append(args, c.Services...)
+
+	cmd := c.compose.CommonCmd(args...)
+
+	var outputs []io.Writer
+	var closers []io.Closer
+	closeAll := func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
 
-	var logFile *os.File
 	if c.Log != "" {
-		var err error
-		logFile, err = os.Create(c.Log)
+		logFile, err := os.Create(c.Log)
 		if err != nil {
 			return nil, err
 		}
-		cmd.Stdout = logFile
+		outputs = append(outputs, logFile)
+		closers = append(closers, logFile)
 	}
 
-	if err := cmd.Start(); err != nil {
-		if logFile != nil {
-			logFile.Close()
+	if c.SaveLogs {
+		w, err := newServiceLogWriter(c.project, nil, false, c.LogDir)
+		if err != nil {
+			closeAll()
+			return nil, err
 		}
+		dockerLog.WithField("dir", c.LogDir).Info("Writing service logs")
+		outputs = append(outputs, w)
+		closers = append(closers, w)
+	}
+
+	// Use the same writer for stdout and stderr so that the output is
+	// interleaved in the order it was written.
+	out := io.MultiWriter(append(outputs, ioutil.Discard)...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	if err := cmd.Start(); err != nil {
+		closeAll()
 		return nil, err
 	}
 
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		cmd.Wait()
-		if logFile != nil {
-			logFile.Close()
-		}
+		closeAll()
 	}()
 
-	return cmd, nil
+	return func() {
+		if err := cmd.SendCtrlCSignal(); err != nil {
+			dockerLog.WithError(err).Warn("failed to stop services")
+			return
+		}
+		<-done
+	}, nil
+}
+
+// userShell returns the user's preferred shell. It uses $SHELL (or %COMSPEC%
+// on Windows) and falls back to the first of bash or sh found in the PATH.
+func userShell() string {
+	if runtime.GOOS == "windows" {
+		if comspec := os.Getenv("COMSPEC"); comspec != "" {
+			return comspec
+		}
+		return "cmd.exe"
+	}
+
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+
+	for _, shell := range []string{"bash", "sh"} {
+		if path, err := exec.LookPath(shell); err == nil {
+			return path
+		}
+	}
+	return "/bin/sh"
 }
 
-func shell(env map[string]string) error {
+// run executes the given command attached to the current terminal. The
+// variables in env are added to the current process's environment.
+func run(env map[string]string, name string, args ...string) error {
 	envVars := os.Environ()
 	for k, v := range env {
 		envVars = append(envVars, fmt.Sprintf("%v=%v", k, v))
 	}
 
-	cmd := &exec.Cmd{
-		Path:   "/bin/bash",
-		Env:    envVars,
-		Stdin:  os.Stdin,
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
-	}
+	dockerLog.WithField("cmd", append([]string{name}, args...)).Debug("Running command")
+	cmd := exec.Command(name, args...)
+	cmd.Env = envVars
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 
 	return cmd.Run()
 }
 
+// Config is the subset of the docker-compose config that is used by bake.
 type Config struct {
+	Name     string // Only reported by Compose v2.
 	Services map[string]Service
 }
 
 type Service struct {
-	Ports []string
+	Ports []ServicePort
+}
+
+// ServicePort is a container port declared by a service. Compose v1 reports
+// ports using the short syntax ("8080:80/tcp") while Compose v2 uses the long
+// syntax (a mapping with target, published, and protocol).
+type ServicePort struct {
+	Target   string
+	Protocol string
+}
+
+func (p *ServicePort) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var short string
+	if err := unmarshal(&short); err == nil {
+		*p = parseShortPort(short)
+		return nil
+	}
+
+	var long struct {
+		Target   string
+		Protocol string
+	}
+	if err := unmarshal(&long); err != nil {
+		return err
+	}
+	p.Target = long.Target
+	p.Protocol = long.Protocol
+	if p.Protocol == "" {
+		p.Protocol = "tcp"
+	}
+	return nil
+}
+
+// parseShortPort parses the container port and protocol from the short port
+// syntax ([[ip:]host_port:]container_port[/protocol]).
+func parseShortPort(port string) ServicePort {
+	p := ServicePort{Target: port, Protocol: "tcp"}
+	if i := strings.LastIndex(p.Target, "/"); i != -1 {
+		p.Protocol = p.Target[i+1:]
+		p.Target = p.Target[:i]
+	}
+	if i := strings.LastIndex(p.Target, ":"); i != -1 {
+		p.Target = p.Target[i+1:]
+	}
+	return p
 }
 
-func getServicePorts(fileArgs []string, config []byte) (map[string]string, error) {
-	c := Config{}
-	err := yaml.Unmarshal(config, &c)
+// getServiceEnv returns environment variables containing the host and ports of
+// each service. It queries the Docker Engine API for the published ports of
+// the project's containers. If the API is unavailable then it falls back to
+// looking up each port using docker-compose.
+func (c *DockerCommand) getServiceEnv(project string, fileArgs []string, config Config) (map[string]string, error) {
+	client, err := docker.NewClient("")
+	if err == nil {
+		err = client.Ping()
+	}
+	if err != nil {
+		dockerLog.WithError(err).Warn("docker api unavailable, falling back to docker-compose port lookups")
+		return c.getServicePorts(fileArgs, config), nil
+	}
+
+	containers, err := c.waitForServices(client, project, config, serviceStartTimeout)
 	if err != nil {
 		return nil, err
 	}
 
+	return serviceEnv(containers), nil
+}
+
+// selectedServices returns the names of the services that were requested to
+// be started. If none were requested then all services are returned.
+func (c *DockerCommand) selectedServices(config Config) []string {
+	if len(c.Services) > 0 {
+		return c.Services
+	}
+
+	var names []string
+	for name := range config.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// instances returns the number of instances of the service that will be run.
+func (c *DockerCommand) instances(service string) int {
+	if n, found := c.scale[service]; found {
+		return n
+	}
+	return 1
+}
+
+// waitForServices polls the Docker Engine API until each instance of the
+// selected services that declare ports has a container with published ports.
+func (c *DockerCommand) waitForServices(client *docker.Client, project string, config Config, timeout time.Duration) ([]docker.Container, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		containers, err := client.ProjectContainers(project)
+		if err != nil {
+			return nil, err
+		}
+
+		published := map[string]int{}
+		for _, container := range containers {
+			if len(container.PublishedPorts()) > 0 {
+				published[container.Service()]++
+			}
+		}
+
+		var pending []string
+		for _, name := range c.selectedServices(config) {
+			if len(config.Services[name].Ports) > 0 && published[name] < c.instances(name) {
+				pending = append(pending, name)
+			}
+		}
+
+		if len(pending) == 0 {
+			return containers, nil
+		}
+
+		if time.Now().After(deadline) {
+			dockerLog.WithField("services", pending).Error("timeout waiting for services, they will be unavailable")
+			return containers, nil
+		}
+
+		dockerLog.WithField("services", pending).Debug("waiting for services to publish ports")
+		time.Sleep(time.Second)
+	}
+}
+
+// serviceEnv returns the host and port environment variables for the
+// published ports of the given containers. The unindexed variables
+// (<SVC>_HOST) refer to the first instance of a service. When a service is
+// scaled to multiple instances then indexed variables (<SVC>_<N>_HOST) are
+// added for each instance.
+func serviceEnv(containers []docker.Container) map[string]string {
+	instances := map[string]int{}
+	for _, container := range containers {
+		instances[container.Service()]++
+	}
+
 	env := map[string]string{}
-	for name, service := range c.Services {
-		for _, port := range service.Ports {
-			upperServiceName := strings.ToUpper(name)
-			hostKey := fmt.Sprintf("%s_HOST", upperServiceName)
-			portKey := fmt.Sprintf("%s_PORT_%s_TCP_PORT", upperServiceName, port)
-
-			host, mappedPort, err := getPortMapping(fileArgs, name, port)
-			if err != nil {
-				dockerLog.WithError(err).Error("service will be unavailable")
+	for _, container := range containers {
+		for _, port := range container.PublishedPorts() {
+			host, mappedPort := port.HostAddress()
+			portNum := strconv.Itoa(port.PrivatePort)
+			dockerLog.Infof("service %v_%d %v", container.Service(), container.Number(), port)
+
+			if container.Number() == 1 {
+				addServiceEnv(env, container.Service(), 0, portNum, port.Type, host, mappedPort)
 			}
+			if instances[container.Service()] > 1 {
+				addServiceEnv(env, container.Service(), container.Number(), portNum, port.Type, host, mappedPort)
+			}
+		}
+	}
+	return env
+}
+
+// addServiceEnv adds the host and port variables for a service port to env.
+// If index is greater than zero then the variable names include the instance
+// index of the service.
+func addServiceEnv(env map[string]string, service string, index int, port, protocol, host, mappedPort string) {
+	prefix := strings.ToUpper(service)
+	if index > 0 {
+		prefix = fmt.Sprintf("%s_%d", prefix, index)
+	}
 
-			env[hostKey] = host
-			env[portKey] = mappedPort
+	env[prefix+"_HOST"] = host
+	env[fmt.Sprintf("%s_PORT_%s_%s_PORT", prefix, port, strings.ToUpper(protocol))] = mappedPort
+}
+
+func (c *DockerCommand) getServicePorts(fileArgs []string, config Config) map[string]string {
+	env := map[string]string{}
+	for _, name := range c.selectedServices(config) {
+		instances := c.instances(name)
+		for _, port := range config.Services[name].Ports {
+			for index := 1; index <= instances; index++ {
+				host, mappedPort, err := c.getPortMapping(fileArgs, name, index, port)
+				if err != nil {
+					dockerLog.WithError(err).Error("service will be unavailable")
+				}
+
+				if index == 1 {
+					addServiceEnv(env, name, 0, port.Target, port.Protocol, host, mappedPort)
+				}
+				if instances > 1 {
+					addServiceEnv(env, name, index, port.Target, port.Protocol, host, mappedPort)
+				}
+			}
 		}
 	}
-	return env, nil
+	return env
 }
 
-func getPortMapping(fileArgs []string, service, port string) (string, string, error) {
-	mapping, err := exec.Command(dockerComposeCmd, append(fileArgs, "port", service, port)...).Output()
+func (c *DockerCommand) getPortMapping(fileArgs []string, service string, index int, port ServicePort) (string, string, error) {
+	args := append(fileArgs[:len(fileArgs):len(fileArgs)], "port", "--protocol", port.Protocol, "--index", strconv.Itoa(index), service, port.Target)
+	mapping, err := c.compose.Cmd(args...).Output()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
-			return "", "", errors.Wrapf(err, "failed to get docker-compose port mapping for %s:%s (%v)", service, port, string(bytes.TrimSpace(exitErr.Stderr)))
+			return "", "", errors.Wrapf(err, "failed to get docker-compose port mapping for %s:%s (%v)", service, port.Target, string(bytes.TrimSpace(exitErr.Stderr)))
 		}
-		return "", "", errors.Wrapf(err, "failed to get docker-compose port mapping for %s:%s", service, port)
+		return "", "", errors.Wrapf(err, "failed to get docker-compose port mapping for %s:%s", service, port.Target)
 	}
 
-	mappedHostPort := string(bytes.TrimSpace(mapping))
-
-	dockerLog.Infof("service %v %v->%v", service, mappedHostPort, port)
-	host, port, err := net.SplitHostPort(mappedHostPort)
+	host, mappedPort, err := docker.ParsePortOutput(mapping)
 	if err != nil {
 		return "", "", err
 	}
 
-	if ip := net.ParseIP(host); ip != nil {
-		switch {
-		case ip.Equal(net.IPv4zero):
-			host = "127.0.0.1"
-		case ip.Equal(net.IPv6zero):
-			host = net.IPv6loopback.String()
-		}
-	}
-
-	return host, port, nil
+	dockerLog.Infof("service %v %v->%v/%v", service, net.JoinHostPort(host, mappedPort), port.Target, port.Protocol)
+	return host, mappedPort, nil
 }
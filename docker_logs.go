@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/joeshaw/multierror"
+	"github.com/pkg/errors"
+)
+
+// composeLogName is the name of the file that receives lines of compose
+// output that are not associated with a service (e.g. status messages).
+const composeLogName = "compose"
+
+// logColors are the ANSI color codes assigned to services in order of first
+// appearance.
+var logColors = []string{"36", "33", "32", "35", "34", "96", "93", "92", "95", "94"}
+
+// instanceSuffixRegex matches the instance number that compose appends to
+// container names (redis_1 in v1, redis-1 in v2).
+var instanceSuffixRegex = regexp.MustCompile(`[_-]\d+$`)
+
+// serviceLogWriter parses the prefixed output of `compose up` and `compose
+// logs` line by line. Each line is written to the console (with the prefix
+// colorized) and to a log file for the service when a directory is given.
+type serviceLogWriter struct {
+	project string
+	console io.Writer // May be nil.
+	color   bool
+	dir     string // May be empty.
+
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	files  map[string]*os.File
+	colors map[string]string
+}
+
+func newServiceLogWriter(project string, console io.Writer, color bool, dir string) (*serviceLogWriter, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, errors.Wrap(err, "failed to create service log directory")
+		}
+	}
+
+	return &serviceLogWriter{
+		project: project,
+		console: console,
+		color:   color,
+		dir:     dir,
+		files:   map[string]*os.File{},
+		colors:  map[string]string{},
+	}, nil
+}
+
+func (w *serviceLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i == -1 {
+			break
+		}
+
+		line := string(w.buf.Next(i + 1))
+		if err := w.writeLine(strings.TrimRight(line, "\r\n")); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Close writes any incomplete line that remains buffered and closes the log
+// files.
+func (w *serviceLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var errs multierror.Errors
+	if w.buf.Len() > 0 {
+		if err := w.writeLine(w.buf.String()); err != nil {
+			errs = append(errs, err)
+		}
+		w.buf.Reset()
+	}
+
+	for _, f := range w.files {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	w.files = map[string]*os.File{}
+	return errs.Err()
+}
+
+func (w *serviceLogWriter) writeLine(line string) error {
+	prefix, service, msg := parseServiceLogLine(w.project, line)
+
+	if w.console != nil {
+		if prefix == "" {
+			fmt.Fprintln(w.console, line)
+		} else if w.color {
+			fmt.Fprintf(w.console, "\x1b[%sm%s |\x1b[0m %s\n", w.colorOf(service), prefix, msg)
+		} else {
+			fmt.Fprintf(w.console, "%s | %s\n", prefix, msg)
+		}
+	}
+
+	if w.dir == "" {
+		return nil
+	}
+
+	name := service
+	if name == "" {
+		name = composeLogName
+	}
+	f, err := w.file(name)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, line)
+	return err
+}
+
+func (w *serviceLogWriter) colorOf(service string) string {
+	c, found := w.colors[service]
+	if !found {
+		c = logColors[len(w.colors)%len(logColors)]
+		w.colors[service] = c
+	}
+	return c
+}
+
+func (w *serviceLogWriter) file(name string) (*os.File, error) {
+	if f, found := w.files[name]; found {
+		return f, nil
+	}
+
+	f, err := os.Create(filepath.Join(w.dir, name+".log"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create service log file")
+	}
+	w.files[name] = f
+	return f, nil
+}
+
+// parseServiceLogLine splits a line of compose log output (e.g.
+// "beats_redis_1  | Ready to accept connections") into the container prefix,
+// the service name, and the message. If the line does not have a prefix then
+// the prefix and service are empty and the message is the whole line.
+func parseServiceLogLine(project, line string) (prefix, service, msg string) {
+	i := strings.Index(line, " | ")
+	if i == -1 {
+		return "", "", line
+	}
+
+	prefix = strings.TrimSpace(line[:i])
+	if prefix == "" || strings.ContainsAny(prefix, " \t") {
+		return "", "", line
+	}
+	msg = line[i+3:]
+
+	service = instanceSuffixRegex.ReplaceAllString(prefix, "")
+	if project != "" {
+		for _, sep := range []string{"_", "-"} {
+			service = strings.TrimPrefix(service, project+sep)
+		}
+	}
+	return prefix, service, msg
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseServiceLogLine(t *testing.T) {
+	testCases := []struct {
+		line, prefix, service, msg string
+	}{
+		{"beats_redis_1  | Ready to accept connections", "beats_redis_1", "redis", "Ready to accept connections"},
+		{"redis-1  | Ready to accept connections", "redis-1", "redis", "Ready to accept connections"},
+		{"beats-elasticsearch-2 | started", "beats-elasticsearch-2", "elasticsearch", "started"},
+		{"Creating beats_redis_1 ... done", "", "", "Creating beats_redis_1 ... done"},
+		{"Attaching to beats_redis_1 | x", "", "", "Attaching to beats_redis_1 | x"},
+	}
+
+	for _, tc := range testCases {
+		prefix, service, msg := parseServiceLogLine("beats", tc.line)
+		assert.Equal(t, tc.prefix, prefix, tc.line)
+		assert.Equal(t, tc.service, service, tc.line)
+		assert.Equal(t, tc.msg, msg, tc.line)
+	}
+}
+
+func TestServiceLogWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bake-docker-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	console := new(bytes.Buffer)
+	w, err := newServiceLogWriter("beats", console, false, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines may be split across writes.
+	w.Write([]byte("Creating beats_redis_1 ... done\nbeats_redis_1  | Ready"))
+	w.Write([]byte(" to accept connections\nbeats_redis_1  | partial"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "Creating beats_redis_1 ... done\n"+
+		"beats_redis_1 | Ready to accept connections\n"+
+		"beats_redis_1 | partial\n", console.String())
+
+	redisLog, err := ioutil.ReadFile(filepath.Join(dir, "redis.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "beats_redis_1  | Ready to accept connections\nbeats_redis_1  | partial\n", string(redisLog))
+
+	composeLog, err := ioutil.ReadFile(filepath.Join(dir, "compose.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Creating beats_redis_1 ... done\n", string(composeLog))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andrewkroh/bake/common/docker"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+func TestDockerNormalizeProjectName(t *testing.T) {
+	assert.Equal(t, "metricbeat", normalizeProjectName("metricbeat", false))
+	assert.Equal(t, "mybeat2", normalizeProjectName("My_Beat-2", false))
+	assert.Equal(t, "my_beat-2", normalizeProjectName("My_Beat-2", true))
+	assert.Equal(t, "beat", normalizeProjectName("_.Beat", true))
+}
+
+func TestDockerProjectName(t *testing.T) {
+	c := &DockerCommand{Project: "custom"}
+	assert.Equal(t, "custom", c.projectName(Config{}))
+	assert.Equal(t, "from-config", c.projectName(Config{Name: "from-config"}))
+
+	c = &DockerCommand{Files: []string{filepath.Join("testing", "Env-Dir", "docker-compose.yml")}}
+	assert.Equal(t, "envdir", c.projectName(Config{}))
+
+	// Compose v2 keeps the dash when it does not report the name.
+	c.compose = &docker.Compose{Version: "2.0.1"}
+	assert.Equal(t, "env-dir", c.projectName(Config{}))
+}
+
+func TestDockerConfigPorts(t *testing.T) {
+	// Compose v1 uses the short syntax and v2 uses the long syntax.
+	configYAML := `
+name: beats
+services:
+  redis:
+    ports:
+    - "6379"
+    - 127.0.0.1:8125:8125/udp
+  elasticsearch:
+    ports:
+    - mode: ingress
+      target: 9200
+      published: "32768"
+      protocol: tcp
+`
+	c := Config{}
+	if err := yaml.Unmarshal([]byte(configYAML), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "beats", c.Name)
+	assert.Equal(t, []ServicePort{{"6379", "tcp"}, {"8125", "udp"}}, c.Services["redis"].Ports)
+	assert.Equal(t, []ServicePort{{"9200", "tcp"}}, c.Services["elasticsearch"].Ports)
+}
+
+func TestDockerUserShell(t *testing.T) {
+	orig, found := os.LookupEnv("SHELL")
+	defer func() {
+		if found {
+			os.Setenv("SHELL", orig)
+		} else {
+			os.Unsetenv("SHELL")
+		}
+	}()
+
+	os.Setenv("SHELL", "/usr/local/bin/fish")
+	assert.Equal(t, "/usr/local/bin/fish", userShell())
+
+	os.Unsetenv("SHELL")
+	assert.NotEmpty(t, userShell())
+}
+
+func TestDockerScaleFlag(t *testing.T) {
+	// The pre-action runs after the flag values are set and stops the parse
+	// before the command starts any services.
+	errStop := errors.New("stop")
+	var scale string
+	app := kingpin.New("bake", "")
+	registerDockerCommand(app)
+	app.PreAction(func(ctx *kingpin.ParseContext) error {
+		for _, e := range ctx.Elements {
+			if f, ok := e.Clause.(*kingpin.FlagClause); ok && f.Model().Name == "scale" {
+				scale = *e.Value
+			}
+		}
+		return errStop
+	})
+
+	_, err := app.Parse([]string{"docker", "up", "--scale", "redis=2", "redis"})
+	assert.Equal(t, errStop, err)
+	assert.Equal(t, "redis=2", scale)
+}
+
+func TestDockerServiceEnv(t *testing.T) {
+	containers := []docker.Container{
+		{
+			Labels: map[string]string{
+				docker.LabelService:         "redis",
+				docker.LabelContainerNumber: "1",
+			},
+			Ports: []docker.Port{{IP: "0.0.0.0", PrivatePort: 6379, PublicPort: 32768, Type: "tcp"}},
+		},
+	}
+
+	env := serviceEnv(containers)
+	assert.Equal(t, map[string]string{
+		"REDIS_HOST":               "127.0.0.1",
+		"REDIS_PORT_6379_TCP_PORT": "32768",
+	}, env)
+}
+
+func TestDockerServiceEnvDualStack(t *testing.T) {
+	containers := []docker.Container{
+		{
+			Labels: map[string]string{docker.LabelService: "redis"},
+			Ports: []docker.Port{
+				{IP: "0.0.0.0", PrivatePort: 6379, PublicPort: 32768, Type: "tcp"},
+				{IP: "::", PrivatePort: 6379, PublicPort: 32768, Type: "tcp"},
+			},
+		},
+	}
+
+	env := serviceEnv(containers)
+	assert.Equal(t, map[string]string{
+		"REDIS_HOST":               "127.0.0.1",
+		"REDIS_PORT_6379_TCP_PORT": "32768",
+	}, env)
+}
+
+func TestDockerServiceEnvScaled(t *testing.T) {
+	redis := func(num string, port int) docker.Container {
+		return docker.Container{
+			Labels: map[string]string{
+				docker.LabelService:         "redis",
+				docker.LabelContainerNumber: num,
+			},
+			Ports: []docker.Port{{IP: "0.0.0.0", PrivatePort: 6379, PublicPort: port, Type: "tcp"}},
+		}
+	}
+
+	env := serviceEnv([]docker.Container{redis("2", 32769), redis("1", 32768)})
+	assert.Equal(t, map[string]string{
+		"REDIS_HOST":                 "127.0.0.1",
+		"REDIS_PORT_6379_TCP_PORT":   "32768",
+		"REDIS_1_HOST":               "127.0.0.1",
+		"REDIS_1_PORT_6379_TCP_PORT": "32768",
+		"REDIS_2_HOST":               "127.0.0.1",
+		"REDIS_2_PORT_6379_TCP_PORT": "32769",
+	}, env)
+}
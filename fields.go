@@ -0,0 +1,454 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/andrewkroh/bake/common"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// fieldTypes contains the field types that are valid in a fields.yml file. An
+// empty type is treated as keyword.
+var fieldTypes = map[string]bool{
+	"": true, "keyword": true, "text": true, "match_only_text": true, "wildcard": true,
+	"constant_keyword": true, "long": true, "integer": true, "short": true, "byte": true,
+	"double": true, "float": true, "half_float": true, "scaled_float": true,
+	"unsigned_long": true, "date": true, "date_nanos": true, "date_range": true,
+	"boolean": true, "binary": true, "ip": true, "geo_point": true, "object": true,
+	"nested": true, "group": true, "alias": true, "array": true, "flattened": true,
+	"histogram": true, "version": true,
+}
+
+// fieldKeys contains the optional keys of a field definition that are not
+// decoded into a field.
+var fieldKeys = map[string]bool{
+	"required": true, "index": true, "doc_values": true, "object_type": true,
+	"object_type_mapping_type": true, "scaling_factor": true, "dynamic": true,
+	"enabled": true, "analyzer": true, "search_analyzer": true, "norms": true,
+	"ignore_above": true, "multi_fields": true, "copy_to": true, "unit": true,
+	"metric_type": true, "dimension": true, "input_format": true, "output_format": true,
+	"output_precision": true, "pattern": true, "label_color": true, "url_template": true,
+	"open_link_in_current_tab": true, "overwrite": true, "default_field": true,
+	"migration": true, "level": true, "release": true, "deprecated": true,
+	"null_value": true, "possible_values": true, "footnote": true, "store": true,
+	"ignore_malformed": true,
+}
+
+// sectionKeys contains the optional keys of a section that are not decoded
+// into a fieldsSection.
+var sectionKeys = map[string]bool{
+	"short_config": true, "release": true, "anchor": true, "deprecated": true,
+}
+
+// fieldsSection is a top-level entry of a fields.yml file. Each section is a
+// category in the generated field documentation.
+type fieldsSection struct {
+	Key         string                 `yaml:"key,omitempty"`
+	Title       string                 `yaml:"title,omitempty"`
+	Description string                 `yaml:"description,omitempty"`
+	Fields      []*field               `yaml:"fields,omitempty"`
+	Other       map[string]interface{} `yaml:",inline"`
+
+	file string // File that defines the section.
+}
+
+// field is a field definition from a fields.yml file.
+type field struct {
+	Name        string                 `yaml:"name,omitempty"`
+	Type        string                 `yaml:"type,omitempty"`
+	Description string                 `yaml:"description,omitempty"`
+	Example     interface{}            `yaml:"example,omitempty"`
+	Format      string                 `yaml:"format,omitempty"`
+	Path        string                 `yaml:"path,omitempty"`
+	Fields      []*field               `yaml:"fields,omitempty"`
+	Other       map[string]interface{} `yaml:",inline"`
+
+	file string // File that defines the field.
+}
+
+// fieldsFile is a parsed fields.yml file. A file contains either sections
+// (e.g. the fields of a beat or module) or a list of fields (e.g. the fields
+// of a metricset) that are nested into the section of the closest parent
+// directory.
+type fieldsFile struct {
+	Path     string
+	Sections []*fieldsSection
+	Fields   []*field
+}
+
+// loadFieldsFile reads and parses a fields.yml file.
+func loadFieldsFile(path string) (*fieldsFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Determine the kind of file from the first entry.
+	var entries []map[string]interface{}
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, errors.Wrap(err, "invalid YAML")
+	}
+
+	f := &fieldsFile{Path: path}
+	if len(entries) == 0 {
+		return f, nil
+	}
+	if _, isSection := entries[0]["key"]; isSection {
+		if err := yaml.Unmarshal(data, &f.Sections); err != nil {
+			return nil, errors.Wrap(err, "invalid YAML")
+		}
+		for _, s := range f.Sections {
+			s.file = path
+			setFieldsFile(s.Fields, path)
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &f.Fields); err != nil {
+			return nil, errors.Wrap(err, "invalid YAML")
+		}
+		setFieldsFile(f.Fields, path)
+	}
+	return f, nil
+}
+
+func setFieldsFile(fields []*field, path string) {
+	for _, f := range fields {
+		if f == nil {
+			continue
+		}
+		f.file = path
+		setFieldsFile(f.Fields, path)
+	}
+}
+
+// defaultFieldsFiles are the glob patterns used to find fields.yml files when
+// none are configured.
+var defaultFieldsFiles = []string{"_meta/fields*.yml", "**/_meta/fields*.yml"}
+
+// findYAMLFiles returns the .yml files beneath root that match the patterns.
+// Files are ordered by the first pattern that they match and then by path.
+// Vendor directories are only searched when a pattern begins with vendor/.
+func findYAMLFiles(root string, patterns []string) ([]string, error) {
+	searchVendor := false
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "vendor/") {
+			searchVendor = true
+		}
+	}
+
+	var candidates []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if name := info.Name(); path != root && (name == ".git" || (name == "vendor" && !searchVendor)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) == ".yml" {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			candidates = append(candidates, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search for YAML files")
+	}
+	sort.Strings(candidates)
+
+	var files []string
+	seen := map[string]bool{}
+	for _, p := range patterns {
+		for _, c := range candidates {
+			if !seen[c] && common.MatchGlob(p, c) {
+				seen[c] = true
+				files = append(files, filepath.Join(root, filepath.FromSlash(c)))
+			}
+		}
+	}
+	return files, nil
+}
+
+// fieldsOwner returns the directory that a fields file describes. Files in a
+// _meta directory describe its parent directory.
+func fieldsOwner(path string) string {
+	dir := filepath.Dir(path)
+	if filepath.Base(dir) == "_meta" {
+		return filepath.Dir(dir)
+	}
+	return dir
+}
+
+// combineFields combines the fields files into a single list of sections.
+// Files containing only fields are appended to the last section of the file
+// in the closest parent directory. When that section ends with a group the
+// fields are added to the group. A finding is returned for each file without
+// a parent section.
+func combineFields(check string, files []*fieldsFile) ([]*fieldsSection, []Finding) {
+	var sections []*fieldsSection
+	var findings []Finding
+	for _, f := range files {
+		sections = append(sections, f.Sections...)
+	}
+
+	for _, f := range files {
+		if len(f.Fields) == 0 {
+			continue
+		}
+
+		owner := fieldsOwner(f.Path)
+		var parent *fieldsFile
+		var distance int
+		for _, p := range files {
+			if len(p.Sections) == 0 {
+				continue
+			}
+			rel, err := filepath.Rel(fieldsOwner(p.Path), owner)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			if parent == nil || len(rel) < distance {
+				parent, distance = p, len(rel)
+			}
+		}
+		if parent == nil {
+			findings = append(findings, Finding{
+				Check:    check,
+				File:     f.Path,
+				Message:  "fields file has no parent section (a fields.yml with a key in a parent directory)",
+				Severity: SeverityError,
+			})
+			continue
+		}
+
+		s := parent.Sections[len(parent.Sections)-1]
+		if n := len(s.Fields); n > 0 && s.Fields[n-1] != nil && s.Fields[n-1].Type == "group" {
+			s.Fields[n-1].Fields = append(s.Fields[n-1].Fields, f.Fields...)
+		} else {
+			s.Fields = append(s.Fields, f.Fields...)
+		}
+	}
+
+	return sections, findings
+}
+
+// fieldsValidator validates combined sections.
+type fieldsValidator struct {
+	check    string
+	findings []Finding
+	keys     map[string]*fieldsSection
+	groups   map[string]*field
+	leaves   map[string]*field
+	names    []string // Leaf names in definition order.
+}
+
+// validateFields returns findings for invalid sections and fields. It checks
+// for missing required keys, invalid types, duplicate field names, and
+// fields that are nested beneath a non-group field.
+func validateFields(check string, sections []*fieldsSection) []Finding {
+	v := &fieldsValidator{
+		check:  check,
+		keys:   map[string]*fieldsSection{},
+		groups: map[string]*field{},
+		leaves: map[string]*field{},
+	}
+
+	for _, s := range sections {
+		v.validateSection(s)
+	}
+
+	// A leaf field cannot be the parent of another field.
+	for _, name := range v.names {
+		for i := 0; i < len(name); i++ {
+			if name[i] != '.' {
+				continue
+			}
+			if parent, found := v.leaves[name[:i]]; found {
+				v.errorf(v.leaves[name].file, "field %v is nested beneath field %v of type %v which is not a group",
+					name, name[:i], fieldType(parent))
+			}
+		}
+	}
+
+	return v.findings
+}
+
+func (v *fieldsValidator) validateSection(s *fieldsSection) {
+	if s.Key == "" {
+		v.errorf(s.file, "section %q is missing the key", s.Title)
+	} else if other, found := v.keys[s.Key]; found {
+		v.errorf(s.file, "section key %v is already defined in %v", s.Key, other.file)
+	} else {
+		v.keys[s.Key] = s
+	}
+
+	for _, k := range sortedKeys(s.Other) {
+		if !sectionKeys[k] {
+			v.warnf(s.file, "section %v has unknown key %v", s.Key, k)
+		}
+	}
+
+	for _, f := range s.Fields {
+		v.validateField(s.file, "", f)
+	}
+}
+
+func (v *fieldsValidator) validateField(file, prefix string, f *field) {
+	if f == nil {
+		v.errorf(file, "empty field definition in %v", orRoot(prefix))
+		return
+	}
+
+	if f.Name == "" {
+		v.errorf(f.file, "field in %v is missing the name", orRoot(prefix))
+		return
+	}
+	name := f.Name
+	if prefix != "" {
+		name = prefix + "." + f.Name
+	}
+	if strings.HasPrefix(f.Name, ".") || strings.HasSuffix(f.Name, ".") || strings.Contains(f.Name, "..") {
+		v.errorf(f.file, "field %v has an invalid name", name)
+	}
+
+	if !fieldTypes[f.Type] {
+		v.errorf(f.file, "field %v has invalid type %v", name, f.Type)
+	}
+	switch f.Type {
+	case "group":
+		if len(f.Fields) == 0 {
+			v.errorf(f.file, "group %v has no fields", name)
+		}
+	case "nested", "object":
+	default:
+		if len(f.Fields) > 0 {
+			v.errorf(f.file, "field %v of type %v cannot contain fields (use type group)", name, fieldType(f))
+		}
+	}
+	if f.Type == "alias" && f.Path == "" {
+		v.errorf(f.file, "alias %v is missing the path", name)
+	} else if f.Type != "alias" && f.Path != "" {
+		v.errorf(f.file, "field %v has a path but is not an alias", name)
+	}
+
+	for _, k := range sortedKeys(f.Other) {
+		if !fieldKeys[k] {
+			v.warnf(f.file, "field %v has unknown key %v", name, k)
+		}
+	}
+
+	if f.Type == "group" {
+		if leaf, found := v.leaves[name]; found {
+			v.errorf(f.file, "group %v conflicts with field of type %v defined in %v", name, fieldType(leaf), leaf.file)
+		}
+		v.groups[name] = f
+	} else {
+		if other, found := v.leaves[name]; found {
+			v.errorf(f.file, "field %v is already defined in %v", name, other.file)
+		} else if group, found := v.groups[name]; found {
+			v.errorf(f.file, "field %v of type %v conflicts with group defined in %v", name, fieldType(f), group.file)
+		} else {
+			v.leaves[name] = f
+			v.names = append(v.names, name)
+		}
+	}
+
+	for _, child := range f.Fields {
+		v.validateField(f.file, name, child)
+	}
+}
+
+func (v *fieldsValidator) errorf(file, format string, args ...interface{}) {
+	v.add(file, SeverityError, format, args...)
+}
+
+func (v *fieldsValidator) warnf(file, format string, args ...interface{}) {
+	v.add(file, SeverityWarning, format, args...)
+}
+
+func (v *fieldsValidator) add(file string, severity Severity, format string, args ...interface{}) {
+	v.findings = append(v.findings, Finding{
+		Check:    v.check,
+		File:     file,
+		Message:  fmt.Sprintf(format, args...),
+		Severity: severity,
+	})
+}
+
+// fieldType returns the type of the field. Fields without a type are
+// keywords.
+func fieldType(f *field) string {
+	if f.Type == "" {
+		return "keyword"
+	}
+	return f.Type
+}
+
+func orRoot(prefix string) string {
+	if prefix == "" {
+		return "the section"
+	}
+	return prefix
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// beatFields contains the fields of a beat.
+type beatFields struct {
+	Files    []*fieldsFile
+	Sections []*fieldsSection // Combined sections of all files.
+}
+
+// loadBeatFields finds, parses, and combines the project's fields.yml files.
+// Problems with individual files are returned as findings. It returns nil if
+// the project does not have any fields files.
+func loadBeatFields(check string) (*beatFields, []Finding, error) {
+	files, err := findYAMLFiles(ProjectRootRel, projectConfig.Fields.Patterns())
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err = projectConfig.Files.Filter().Filter(files)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil, nil
+	}
+
+	var findings []Finding
+	fields := &beatFields{}
+	for _, path := range files {
+		f, err := loadFieldsFile(path)
+		if err != nil {
+			findings = append(findings, Finding{
+				Check:    check,
+				File:     path,
+				Message:  err.Error(),
+				Severity: SeverityError,
+			})
+			continue
+		}
+		fields.Files = append(fields.Files, f)
+	}
+
+	sections, problems := combineFields(check, fields.Files)
+	fields.Sections = sections
+	return fields, append(findings, problems...), nil
+}
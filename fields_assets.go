@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// assetPackage is the import path of the libbeat package that the fields.go
+// asset registers the fields with.
+const assetPackage = "github.com/elastic/beats/libbeat/asset"
+
+// combinedFieldsYAML returns the combined fields.yml of a Beat.
+func combinedFieldsYAML(sections []*fieldsSection) ([]byte, error) {
+	data, err := yaml.Marshal(sections)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal fields")
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("# This file is generated! See the _meta/fields.yml files and bake update.\n\n")
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+var fieldsAssetTemplate = template.Must(template.New("fields.go").Parse(
+	`// Code generated by bake update. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"{{.AssetPackage}}"
+)
+
+func init() {
+	if err := asset.SetFields("{{.Beat}}", "{{.Name}}", Asset); err != nil {
+		panic(err)
+	}
+}
+
+// Asset returns the base64 encoded, zlib compressed contents of {{.Name}}.
+func Asset() string {
+	return "{{.Data}}"
+}
+`))
+
+// fieldsGoAsset returns the source of a Go file that embeds the combined
+// fields.yml and registers it with the libbeat asset registry.
+func fieldsGoAsset(beat, pkg string, fieldsYML []byte) ([]byte, error) {
+	compressed := new(bytes.Buffer)
+	w, err := zlib.NewWriterLevel(compressed, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(fieldsYML); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	err = fieldsAssetTemplate.Execute(buf, map[string]string{
+		"Package":      pkg,
+		"AssetPackage": assetPackage,
+		"Beat":         beat,
+		"Name":         "fields.yml",
+		"Data":         base64.StdEncoding.EncodeToString(compressed.Bytes()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gofmtSource("fields.go", buf.Bytes())
+}
+
+// templateMappingKeys are the keys of a field definition that are copied to
+// the field's mapping in the Elasticsearch template.
+var templateMappingKeys = []string{
+	"analyzer", "copy_to", "doc_values", "dynamic", "enabled", "ignore_above",
+	"ignore_malformed", "index", "norms", "null_value", "scaling_factor",
+	"search_analyzer", "store",
+}
+
+// elasticsearchTemplate returns the Elasticsearch index template that maps
+// the fields of the Beat's indices. Strings that are not defined in the
+// fields are mapped as keywords.
+func elasticsearchTemplate(beat, indexPrefix string, sections []*fieldsSection) ([]byte, error) {
+	properties := map[string]interface{}{}
+	for _, s := range sections {
+		for _, f := range s.Fields {
+			addFieldMapping(properties, f)
+		}
+	}
+
+	out, err := json.MarshalIndent(map[string]interface{}{
+		"index_patterns": []string{indexPrefix + "-*"},
+		"order":          1,
+		"settings": map[string]interface{}{
+			"index": map[string]interface{}{
+				"mapping": map[string]interface{}{
+					"total_fields": map[string]interface{}{"limit": 10000},
+				},
+				"refresh_interval": "5s",
+			},
+		},
+		"mappings": map[string]interface{}{
+			"_meta":          map[string]string{"beat": beat},
+			"date_detection": false,
+			"dynamic_templates": []interface{}{
+				map[string]interface{}{
+					"strings_as_keyword": map[string]interface{}{
+						"match_mapping_type": "string",
+						"mapping":            map[string]interface{}{"type": "keyword", "ignore_above": 1024},
+					},
+				},
+			},
+			"properties": properties,
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal template")
+	}
+	return append(out, '\n'), nil
+}
+
+// addFieldMapping adds the mapping of the field to properties. Groups with
+// the same name are merged. Arrays are not mapped because Elasticsearch maps
+// them by the type of their elements.
+func addFieldMapping(properties map[string]interface{}, f *field) {
+	if f == nil || f.Type == "array" {
+		return
+	}
+
+	if f.Type == "group" {
+		group, _ := properties[f.Name].(map[string]interface{})
+		if group == nil {
+			group = map[string]interface{}{}
+			properties[f.Name] = group
+		}
+		children, _ := group["properties"].(map[string]interface{})
+		if children == nil {
+			children = map[string]interface{}{}
+			group["properties"] = children
+		}
+		for _, child := range f.Fields {
+			addFieldMapping(children, child)
+		}
+		return
+	}
+
+	mapping := map[string]interface{}{"type": fieldType(f)}
+	switch f.Type {
+	case "", "keyword":
+		mapping["ignore_above"] = 1024
+	case "scaled_float":
+		mapping["scaling_factor"] = 1000
+	case "alias":
+		mapping["path"] = f.Path
+	}
+	for _, k := range templateMappingKeys {
+		if v, found := f.Other[k]; found {
+			mapping[k] = v
+		}
+	}
+	if len(f.Fields) > 0 {
+		children := map[string]interface{}{}
+		for _, child := range f.Fields {
+			addFieldMapping(children, child)
+		}
+		mapping["properties"] = children
+	}
+	properties[f.Name] = mapping
+}
+
+// kibanaFieldTypes maps field types to Kibana index pattern field types.
+// Fields with other types are not included in the index pattern.
+var kibanaFieldTypes = map[string]string{
+	"":                 "string",
+	"keyword":          "string",
+	"text":             "string",
+	"match_only_text":  "string",
+	"wildcard":         "string",
+	"constant_keyword": "string",
+	"version":          "string",
+	"long":             "number",
+	"integer":          "number",
+	"short":            "number",
+	"byte":             "number",
+	"double":           "number",
+	"float":            "number",
+	"half_float":       "number",
+	"scaled_float":     "number",
+	"unsigned_long":    "number",
+	"date":             "date",
+	"date_nanos":       "date",
+	"boolean":          "boolean",
+	"ip":               "ip",
+	"geo_point":        "geo_point",
+}
+
+// kibanaField is a field in a Kibana index pattern.
+type kibanaField struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Count        int    `json:"count"`
+	Scripted     bool   `json:"scripted"`
+	Indexed      bool   `json:"indexed"`
+	Analyzed     bool   `json:"analyzed"`
+	DocValues    bool   `json:"doc_values"`
+	Searchable   bool   `json:"searchable"`
+	Aggregatable bool   `json:"aggregatable"`
+}
+
+// kibanaIndexPattern returns the Kibana index pattern saved object for the
+// index prefix. Field formats (e.g. bytes or percent) are added to the
+// pattern's field format map.
+func kibanaIndexPattern(indexPrefix string, sections []*fieldsSection) ([]byte, error) {
+	var fields []kibanaField
+	formats := map[string]interface{}{}
+
+	var add func(prefix string, f *field)
+	add = func(prefix string, f *field) {
+		if f == nil {
+			return
+		}
+		name := f.Name
+		if prefix != "" {
+			name = prefix + "." + f.Name
+		}
+		for _, child := range f.Fields {
+			add(name, child)
+		}
+
+		kibanaType, found := kibanaFieldTypes[f.Type]
+		if !found || len(f.Fields) > 0 {
+			return
+		}
+		analyzed := f.Type == "text" || f.Type == "match_only_text"
+		fields = append(fields, kibanaField{
+			Name:         name,
+			Type:         kibanaType,
+			Indexed:      true,
+			Analyzed:     analyzed,
+			DocValues:    !analyzed,
+			Searchable:   true,
+			Aggregatable: !analyzed,
+		})
+		if f.Format != "" {
+			formats[name] = map[string]string{"id": f.Format}
+		}
+	}
+	for _, s := range sections {
+		for _, f := range s.Fields {
+			add("", f)
+		}
+	}
+
+	fieldsJSON, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	formatsJSON, err := json.Marshal(formats)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := indexPrefix + "-*"
+	out, err := json.MarshalIndent(map[string]interface{}{
+		"objects": []interface{}{
+			map[string]interface{}{
+				"type":    "index-pattern",
+				"id":      pattern,
+				"version": 1,
+				"attributes": map[string]interface{}{
+					"title":          pattern,
+					"timeFieldName":  "@timestamp",
+					"fields":         string(fieldsJSON),
+					"fieldFormatMap": string(formatsJSON),
+				},
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
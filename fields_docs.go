@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// generateFieldsDocs returns the asciidoc documentation of the exported
+// fields. Each section is a category of the documentation and each group is
+// a heading within it.
+func generateFieldsDocs(beatTitle string, sections []*fieldsSection) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString(`
+////
+This file is generated! See the _meta/fields.yml files.
+////
+
+[[exported-fields]]
+= Exported fields
+
+[partintro]
+
+--
+`)
+	fmt.Fprintf(buf, "This document describes the fields that are exported by %v. They are\n", beatTitle)
+	buf.WriteString("grouped in the following categories:\n\n")
+	for _, s := range sections {
+		fmt.Fprintf(buf, "* <<exported-fields-%v>>\n", s.Key)
+	}
+	buf.WriteString("\n--\n")
+
+	for _, s := range sections {
+		title := s.Title
+		if title == "" {
+			title = s.Key
+		}
+		fmt.Fprintf(buf, "[[exported-fields-%v]]\n== %v fields\n\n", s.Key, title)
+		writeDescription(buf, s.Description)
+
+		for _, f := range s.Fields {
+			writeFieldDocs(buf, "", f)
+		}
+	}
+
+	return bytes.TrimLeft(buf.Bytes(), "\n")
+}
+
+func writeFieldDocs(buf *bytes.Buffer, prefix string, f *field) {
+	if f == nil {
+		return
+	}
+	name := f.Name
+	if prefix != "" {
+		name = prefix + "." + f.Name
+	}
+
+	if f.Type == "group" {
+		fmt.Fprintf(buf, "[float]\n=== %v\n\n", name)
+		writeDescription(buf, f.Description)
+		for _, child := range f.Fields {
+			writeFieldDocs(buf, name, child)
+		}
+		return
+	}
+
+	fmt.Fprintf(buf, "*`%v`*::\n+\n--\n", name)
+	fmt.Fprintf(buf, "type: %v\n\n", fieldType(f))
+	if f.Type == "alias" {
+		fmt.Fprintf(buf, "alias to: %v\n\n", f.Path)
+	}
+	if f.Example != nil {
+		fmt.Fprintf(buf, "example: %v\n\n", f.Example)
+	}
+	if f.Format != "" {
+		fmt.Fprintf(buf, "format: %v\n\n", f.Format)
+	}
+	if d := strings.TrimSpace(f.Description); d != "" {
+		fmt.Fprintf(buf, "%v\n\n", d)
+	}
+	buf.WriteString("--\n\n")
+
+	for _, child := range f.Fields {
+		writeFieldDocs(buf, name, child)
+	}
+}
+
+func writeDescription(buf *bytes.Buffer, description string) {
+	if d := strings.TrimSpace(description); d != "" {
+		fmt.Fprintf(buf, "%v\n\n", d)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testModuleFields = `
+- key: apache
+  title: "Apache"
+  description: >
+    Apache HTTPD server metrics.
+  short_config: false
+  fields:
+    - name: apache
+      type: group
+      description: >
+        Apache fields.
+      fields:
+`
+
+const testMetricsetFields = `
+- name: status
+  type: group
+  description: >
+    Status metrics.
+  fields:
+    - name: hostname
+      type: keyword
+      example: 192.168.0.1
+      description: >
+        Apache hostname.
+    - name: bytes
+      type: long
+      format: bytes
+      description: Total bytes served.
+`
+
+func writeFieldsFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "bake-fields")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func loadTestFields(t *testing.T, dir string) ([]*fieldsSection, []Finding) {
+	paths, err := findYAMLFiles(dir, defaultFieldsFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []*fieldsFile
+	for _, p := range paths {
+		f, err := loadFieldsFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	return combineFields("fields", files)
+}
+
+func TestFindYAMLFiles(t *testing.T) {
+	dir := writeFieldsFiles(t, map[string]string{
+		"module/apache/status/_meta/fields.yml": testMetricsetFields,
+		"module/apache/_meta/fields.yml":        testModuleFields,
+		"_meta/fields.common.yml":               "",
+		"vendor/x/_meta/fields.yml":             "",
+		"fields.yml":                            "",
+	})
+	defer os.RemoveAll(dir)
+
+	files, err := findYAMLFiles(dir, defaultFieldsFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range files {
+		files[i], _ = filepath.Rel(dir, f)
+		files[i] = filepath.ToSlash(files[i])
+	}
+	assert.Equal(t, []string{
+		"_meta/fields.common.yml",
+		"module/apache/_meta/fields.yml",
+		"module/apache/status/_meta/fields.yml",
+	}, files)
+}
+
+func TestCombineFields(t *testing.T) {
+	dir := writeFieldsFiles(t, map[string]string{
+		"module/apache/_meta/fields.yml":           testModuleFields,
+		"module/apache/status/_meta/fields.yml":    testMetricsetFields,
+		"module/nginx/stubstatus/_meta/fields.yml": testMetricsetFields,
+	})
+	defer os.RemoveAll(dir)
+
+	sections, findings := loadTestFields(t, dir)
+	if assert.Len(t, findings, 1) {
+		assert.Contains(t, findings[0].File, "nginx")
+	}
+	if assert.Len(t, sections, 1) {
+		apache := sections[0].Fields[0]
+		if assert.Len(t, apache.Fields, 1) {
+			assert.Equal(t, "status", apache.Fields[0].Name)
+		}
+	}
+	assert.Empty(t, validateFields("fields", sections))
+}
+
+func TestValidateFields(t *testing.T) {
+	dir := writeFieldsFiles(t, map[string]string{
+		"_meta/fields.yml": `
+- key: test
+  fields:
+    - name: a
+      type: strng
+    - name: b
+      type: group
+    - name: c
+      type: keyword
+      fields:
+        - name: d
+    - name: e
+      type: alias
+    - type: long
+    - name: f
+      colour: red
+    - name: f
+      type: long
+    - name: g.h
+    - name: g
+      type: group
+      fields:
+        - name: h
+          type: long
+    - name: i
+    - name: i.j
+- title: No key
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	sections, findings := loadTestFields(t, dir)
+	assert.Empty(t, findings)
+
+	var messages []string
+	for _, f := range validateFields("fields", sections) {
+		messages = append(messages, string(f.Severity)+": "+f.Message)
+	}
+	assert.Equal(t, []string{
+		"error: field a has invalid type strng",
+		"error: group b has no fields",
+		"error: field c of type keyword cannot contain fields (use type group)",
+		"error: alias e is missing the path",
+		"error: field in the section is missing the name",
+		"warning: field f has unknown key colour",
+		"error: field f is already defined in " + filepath.Join(dir, "_meta", "fields.yml"),
+		"error: field g.h is already defined in " + filepath.Join(dir, "_meta", "fields.yml"),
+		`error: section "No key" is missing the key`,
+		"error: field c.d is nested beneath field c of type keyword which is not a group",
+		"error: field i.j is nested beneath field i of type keyword which is not a group",
+	}, messages)
+}
+
+func TestGenerateFieldsDocs(t *testing.T) {
+	dir := writeFieldsFiles(t, map[string]string{
+		"module/apache/_meta/fields.yml":        testModuleFields,
+		"module/apache/status/_meta/fields.yml": testMetricsetFields,
+	})
+	defer os.RemoveAll(dir)
+
+	sections, _ := loadTestFields(t, dir)
+	docs := string(generateFieldsDocs("Metricbeat", sections))
+
+	assert.True(t, strings.HasPrefix(docs, "////\nThis file is generated!"))
+	assert.Contains(t, docs, "exported by Metricbeat.")
+	assert.Contains(t, docs, "* <<exported-fields-apache>>\n")
+	assert.Contains(t, docs, "[[exported-fields-apache]]\n== Apache fields\n\nApache HTTPD server metrics.\n\n")
+	assert.Contains(t, docs, "[float]\n=== apache.status\n\nStatus metrics.\n\n")
+	assert.Contains(t, docs, "*`apache.status.hostname`*::\n+\n--\ntype: keyword\n\nexample: 192.168.0.1\n\nApache hostname.\n\n--\n")
+	assert.Contains(t, docs, "*`apache.status.bytes`*::\n+\n--\ntype: long\n\nformat: bytes\n\nTotal bytes served.\n\n--\n")
+}
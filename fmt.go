@@ -2,49 +2,110 @@ package main
 
 import (
 	"fmt"
-	"os/exec"
+	"io/ioutil"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/andrewkroh/bake/common"
+	"github.com/pkg/errors"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 func registerFmtCommand(app *kingpin.Application) {
 	cmd := &FmtCommand{}
-	app.Command("fmt", "Run gofmt -s on non-vendor Go files").Action(cmd.Run)
+	fmtCmd := app.Command("fmt", "Run gofmt -s and group imports on non-vendor Go files").Action(cmd.Run)
+	fmtCmd.Flag("since", "Only format Go files changed since the given git ref (including uncommitted changes)").PlaceHolder("REF").StringVar(&cmd.Since)
+	fmtCmd.Flag("headers", "Insert the configured license header into files that are missing it").BoolVar(&cmd.Headers)
+	fmtCmd.Flag("diff", "Print a unified diff of the changes instead of modifying files").BoolVar(&cmd.Diff)
+	fmtCmd.Arg("files", "Go files to format (default: all non-vendor Go files)").StringsVar(&cmd.Files)
 }
 
-type FmtCommand struct{}
+type FmtCommand struct {
+	Since   string
+	Files   []string
+	Headers bool
+	Diff    bool
+}
 
 func (c *FmtCommand) Run(ctx *kingpin.ParseContext) error {
-	files, err := goFmtSimplify()
+	files, err := c.goFiles()
 	if err != nil {
 		return err
 	}
 
-	for _, f := range files {
-		fmt.Println(f)
+	formatter := &sourceFormatter{localImports: projectConfig.Imports.LocalPrefixes()}
+	if c.Headers {
+		formatter.header, err = projectConfig.Headers.LicenseHeader()
+		if err != nil {
+			return err
+		}
+		if formatter.header == nil {
+			return errors.New("no license header is configured (set headers.template or headers.file in " + projectConfigFile + ")")
+		}
+	}
+
+	changed, err := formatFiles(files, formatter.format)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range changed {
+		if c.Diff {
+			if err := writeDiff(os.Stdout, f); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := ioutil.WriteFile(f.File, f.Formatted, 0644); err != nil {
+			return errors.Wrapf(err, "failed to write %v", f.File)
+		}
+		fmt.Println(f.File)
 	}
 
 	return nil
 }
 
-// goFmtSimplify run "gofmt -s" on all non-vendor go files in and below the
-// current directory.
-func goFmtSimplify() ([]string, error) {
-	files, err := common.GoFiles()
+// goFiles returns the files given as arguments or else the non-vendor Go
+// files selected by the --since option. Either way the files are filtered by
+// the project's file filter.
+func (c *FmtCommand) goFiles() ([]string, error) {
+	if len(c.Files) == 0 {
+		return CheckOptions{Since: c.Since}.GoFiles()
+	}
+
+	var files []string
+	for _, f := range c.Files {
+		if strings.HasSuffix(f, ".go") {
+			files = append(files, f)
+		}
+	}
+	return projectConfig.Files.Filter().Filter(files)
+}
+
+// sourceFormatter applies all of the formatting done by bake fmt to a file.
+type sourceFormatter struct {
+	localImports []string
+	header       *licenseHeader // Optional.
+}
+
+// format returns the formatted source. The source is formatted with gofmt -s,
+// then its imports are grouped, and finally the license header is inserted
+// if it is missing.
+func (f *sourceFormatter) format(filename string, src []byte) ([]byte, error) {
+	out, err := gofmtSource(filename, src)
 	if err != nil {
 		return nil, err
 	}
 
-	args := make([]string, 0, len(files)+3)
-	args = append(args, "-s", "-w", "-l")
-	args = append(args, files...)
-
-	out, err := common.RunCommand(exec.Command("gofmt", args...))
+	out, _, err = fixImports(filename, out, f.localImports)
 	if err != nil {
 		return nil, err
 	}
 
-	return strings.Fields(string(out)), nil
+	if f.header != nil && !common.IsGenerated(out) && !f.header.hasHeader(out) {
+		out = f.header.insert(out, time.Now().Year())
+	}
+	return out, nil
 }
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+var generateLog = logrus.WithField("package", "main").WithField("cmd", "generate")
+
+// scaffoldNameRegex matches valid module, metricset, and fileset names. The
+// names are used as Go package names so they are restricted to lower case
+// letters, digits, and underscores.
+var scaffoldNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func registerGenerateCommand(app *kingpin.Application) {
+	cmd := &GenerateCommand{}
+	generate := app.Command("generate", "Generate the skeleton of a new module, metricset, or fileset.")
+
+	module := generate.Command("module", "Generate a new module.").Action(cmd.RunModule)
+	module.Flag("kind", "Kind of module: metrics (Metricbeat) or logs (Filebeat). Defaults to logs for Filebeat and metrics otherwise.").EnumVar(&cmd.Kind, "metrics", "logs")
+	module.Arg("module", "Module name").Required().StringVar(&cmd.Module)
+
+	metricset := generate.Command("metricset", "Generate a new metricset (and its module if it does not exist).").Action(cmd.RunMetricset)
+	metricset.Arg("module", "Module name").Required().StringVar(&cmd.Module)
+	metricset.Arg("metricset", "Metricset name").Required().StringVar(&cmd.Metricset)
+
+	fileset := generate.Command("fileset", "Generate a new fileset (and its module if it does not exist).").Action(cmd.RunFileset)
+	fileset.Arg("module", "Module name").Required().StringVar(&cmd.Module)
+	fileset.Arg("fileset", "Fileset name").Required().StringVar(&cmd.Fileset)
+}
+
+type GenerateCommand struct {
+	Kind      string
+	Module    string
+	Metricset string
+	Fileset   string
+}
+
+// RunModule generates a module. Its fields.yml is created by the first
+// metricset or fileset.
+func (c *GenerateCommand) RunModule(ctx *kingpin.ParseContext) error {
+	kind := c.Kind
+	if kind == "" {
+		kind = "metrics"
+		if projectConfig.Beat.BeatName() == "filebeat" {
+			kind = "logs"
+		}
+	}
+
+	dir := c.moduleDir()
+	if _, err := os.Stat(dir); err == nil {
+		return errors.Errorf("module %v already exists in %v", c.Module, dir)
+	}
+
+	files := metricsModuleFiles
+	if kind == "logs" {
+		files = logsModuleFiles
+	}
+	return c.generate(dir, files, scaffoldParams{Module: c.Module})
+}
+
+// RunMetricset generates a metricset and, if necessary, its module.
+func (c *GenerateCommand) RunMetricset(ctx *kingpin.ParseContext) error {
+	params := scaffoldParams{Module: c.Module, Metricset: c.Metricset, Metricsets: []string{c.Metricset}}
+	return c.generateWithModule(c.Metricset, metricsModuleFiles, metricsModuleFieldsFiles, metricsetFiles, params)
+}
+
+// RunFileset generates a fileset and, if necessary, its module.
+func (c *GenerateCommand) RunFileset(ctx *kingpin.ParseContext) error {
+	params := scaffoldParams{Module: c.Module, Fileset: c.Fileset, Filesets: []string{c.Fileset}}
+	return c.generateWithModule(c.Fileset, logsModuleFiles, logsModuleFieldsFiles, filesetFiles, params)
+}
+
+// generateWithModule generates a metricset or fileset and, if necessary, its
+// module. The module's fields.yml is created with its first metricset or
+// fileset because a module group without fields is invalid.
+func (c *GenerateCommand) generateWithModule(name string, moduleFiles, moduleFieldsFiles, files []scaffoldFile, params scaffoldParams) error {
+	if !scaffoldNameRegex.MatchString(name) {
+		return errors.Errorf("invalid name %q (use lower case letters, digits, and underscores)", name)
+	}
+
+	moduleDir := c.moduleDir()
+	dir := filepath.Join(moduleDir, name)
+	if _, err := os.Stat(dir); err == nil {
+		return errors.Errorf("%v already exists", dir)
+	}
+
+	if _, err := os.Stat(moduleDir); os.IsNotExist(err) {
+		if err := c.generate(moduleDir, moduleFiles, params); err != nil {
+			return err
+		}
+	} else {
+		generateLog.WithField("module", c.Module).Info("module exists, add the new name to its _meta/config.yml")
+	}
+	if _, err := os.Stat(filepath.Join(moduleDir, "_meta", "fields.yml")); os.IsNotExist(err) {
+		if err := c.generate(moduleDir, moduleFieldsFiles, params); err != nil {
+			return err
+		}
+	}
+
+	return c.generate(dir, files, params)
+}
+
+// moduleDir returns the directory of the module relative to the current
+// directory.
+func (c *GenerateCommand) moduleDir() string {
+	return filepath.Join(ProjectRootRel, "module", c.Module)
+}
+
+// generate renders the files into dir and prints the path of each file.
+func (c *GenerateCommand) generate(dir string, files []scaffoldFile, params scaffoldParams) error {
+	if !scaffoldNameRegex.MatchString(params.Module) {
+		return errors.Errorf("invalid module name %q (use lower case letters, digits, and underscores)", params.Module)
+	}
+
+	formatter := &sourceFormatter{localImports: projectConfig.Imports.LocalPrefixes()}
+	header, err := projectConfig.Headers.LicenseHeader()
+	if err != nil {
+		return err
+	}
+	formatter.header = header
+
+	created, err := renderScaffold(dir, files, params, formatter)
+	for _, f := range created {
+		fmt.Println(f)
+	}
+	return err
+}
+
+// scaffoldFile is a file created by bake generate. Both the path (relative to
+// the generated directory) and the content are templates.
+type scaffoldFile struct {
+	Path    string
+	Content string
+}
+
+// scaffoldParams are the parameters available to the scaffold templates.
+type scaffoldParams struct {
+	Module     string
+	Metricset  string
+	Fileset    string
+	Metricsets []string // Metricsets listed in a new module's config.
+	Filesets   []string // Filesets listed in a new module's config.
+
+	Beat       string // Name of a new Beat.
+	ImportPath string // Go import path of a new Beat.
+	Copyright  string // Copyright owner of a new Beat.
+	Year       int    // Copyright begin year of a new Beat.
+}
+
+var scaffoldFuncs = template.FuncMap{
+	"title": func(s string) string {
+		if s == "" {
+			return s
+		}
+		return strings.ToUpper(s[:1]) + s[1:]
+	},
+	"yamlList": func(values []string) string {
+		quoted := make([]string, len(values))
+		for i, v := range values {
+			quoted[i] = `"` + v + `"`
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	},
+	"yaml": func(s string) (string, error) {
+		data, err := yaml.Marshal(s)
+		return strings.TrimSuffix(string(data), "\n"), err
+	},
+}
+
+// renderScaffold renders the files into dir. Existing files are never
+// overwritten. Go files are formatted like bake fmt does, including the
+// license header when one is configured. It returns the files that were
+// created.
+func renderScaffold(dir string, files []scaffoldFile, params scaffoldParams, formatter *sourceFormatter) ([]string, error) {
+	var created []string
+	for _, f := range files {
+		name, err := executeScaffoldTemplate(f.Path, params)
+		if err != nil {
+			return created, err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(string(name)))
+
+		content, err := executeScaffoldTemplate(f.Content, params)
+		if err != nil {
+			return created, errors.Wrapf(err, "failed to render %v", path)
+		}
+		if filepath.Ext(path) == ".go" {
+			if content, err = formatter.format(path, content); err != nil {
+				return created, errors.Wrapf(err, "failed to format %v", path)
+			}
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			return created, errors.Errorf("%v already exists", path)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return created, err
+		}
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			return created, errors.Wrapf(err, "failed to write %v", path)
+		}
+		created = append(created, path)
+	}
+	return created, nil
+}
+
+func executeScaffoldTemplate(text string, params scaffoldParams) ([]byte, error) {
+	tmpl, err := template.New("scaffold").Delims("[[", "]]").Funcs(scaffoldFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, params); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,436 @@
+package main
+
+// The scaffolding templates use [[ and ]] as delimiters so that the files
+// they produce can contain Go template actions (e.g. Filebeat input configs).
+
+// metricsModuleFiles are created for a new Metricbeat module.
+var metricsModuleFiles = []scaffoldFile{
+	{Path: "doc.go", Content: `// Package [[.Module]] is a Metricbeat module that contains MetricSets.
+package [[.Module]]
+`},
+	{Path: "_meta/config.yml", Content: `- module: [[.Module]]
+  metricsets: [[yamlList .Metricsets]]
+  enabled: false
+  period: 10s
+  hosts: ["localhost"]
+`},
+	{Path: "_meta/docs.asciidoc", Content: `== [[title .Module]] module
+
+This is the [[.Module]] module.
+`},
+}
+
+// metricsModuleFieldsFiles are created for a Metricbeat module with its first
+// metricset. The metricsets' fields are added to the module's group, which
+// must not be empty.
+var metricsModuleFieldsFiles = []scaffoldFile{
+	{Path: "_meta/fields.yml", Content: `- key: [[.Module]]
+  title: "[[title .Module]]"
+  description: >
+    [[.Module]] module
+  release: experimental
+  fields:
+    - name: [[.Module]]
+      type: group
+      description: >
+        [[.Module]] module
+      fields:
+`},
+}
+
+// metricsetFiles are created for a new Metricbeat metricset.
+var metricsetFiles = []scaffoldFile{
+	{Path: "[[.Metricset]].go", Content: `package [[.Metricset]]
+
+import (
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/cfgwarn"
+	"github.com/elastic/beats/metricbeat/mb"
+)
+
+// init registers the MetricSet with the central registry. The New method is
+// called after the module is set up and before data is fetched.
+func init() {
+	if err := mb.Registry.AddMetricSet("[[.Module]]", "[[.Metricset]]", New); err != nil {
+		panic(err)
+	}
+}
+
+// MetricSet holds the configuration and state of the [[.Metricset]] metricset.
+type MetricSet struct {
+	mb.BaseMetricSet
+	counter int
+}
+
+// New creates a new instance of the MetricSet.
+func New(base mb.BaseMetricSet) (mb.MetricSet, error) {
+	cfgwarn.Experimental("The [[.Module]] [[.Metricset]] metricset is experimental.")
+
+	config := struct{}{}
+	if err := base.Module().UnpackConfig(&config); err != nil {
+		return nil, err
+	}
+
+	return &MetricSet{
+		BaseMetricSet: base,
+		counter:       1,
+	}, nil
+}
+
+// Fetch fetches the data and converts it to an event. It is called every
+// period.
+func (m *MetricSet) Fetch() (common.MapStr, error) {
+	event := common.MapStr{
+		"counter": m.counter,
+	}
+	m.counter++
+
+	return event, nil
+}
+`},
+	{Path: "[[.Metricset]]_test.go", Content: `package [[.Metricset]]
+
+import (
+	"testing"
+
+	mbtest "github.com/elastic/beats/metricbeat/mb/testing"
+)
+
+func TestFetch(t *testing.T) {
+	f := mbtest.NewEventFetcher(t, getConfig())
+	event, err := f.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("%s/%s event: %+v", f.Module().Name(), f.Name(), event)
+}
+
+func getConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"module":     "[[.Module]]",
+		"metricsets": []string{"[[.Metricset]]"},
+		"hosts":      []string{"localhost"},
+	}
+}
+`},
+	{Path: "_meta/fields.yml", Content: `- name: [[.Metricset]]
+  type: group
+  description: >
+    [[.Metricset]]
+  release: experimental
+  fields:
+    - name: counter
+      type: long
+      description: >
+        Number of times the metricset has been fetched.
+`},
+	{Path: "_meta/docs.asciidoc", Content: `This is the [[.Metricset]] metricset of the module [[.Module]].
+`},
+	{Path: "_meta/data.json", Content: `{
+    "@timestamp": "2017-10-12T08:05:34.853Z",
+    "beat": {
+        "hostname": "host.example.com",
+        "name": "host.example.com"
+    },
+    "metricset": {
+        "host": "localhost",
+        "module": "[[.Module]]",
+        "name": "[[.Metricset]]",
+        "rtt": 115
+    },
+    "[[.Module]]": {
+        "[[.Metricset]]": {
+            "counter": 1
+        }
+    }
+}
+`},
+}
+
+// logsModuleFiles are created for a new Filebeat module.
+var logsModuleFiles = []scaffoldFile{
+	{Path: "_meta/config.yml", Content: `- module: [[.Module]]
+[[- range .Filesets]]
+  # [[.]] logs
+  [[.]]:
+    enabled: true
+
+    # Set custom paths for the log files. If left empty,
+    # Filebeat will choose the paths depending on your OS.
+    #var.paths:
+[[- end]]
+`},
+	{Path: "_meta/docs.asciidoc", Content: `== [[title .Module]] module
+
+This is the [[.Module]] module.
+`},
+}
+
+// logsModuleFieldsFiles are created for a Filebeat module with its first
+// fileset.
+var logsModuleFieldsFiles = []scaffoldFile{
+	{Path: "_meta/fields.yml", Content: `- key: [[.Module]]
+  title: "[[title .Module]]"
+  description: >
+    [[.Module]] module
+  fields:
+    - name: [[.Module]]
+      type: group
+      description: >
+        [[.Module]] module
+      fields:
+`},
+}
+
+// filesetFiles are created for a new Filebeat fileset.
+var filesetFiles = []scaffoldFile{
+	{Path: "manifest.yml", Content: `module_version: 1.0
+
+var:
+  - name: paths
+    default:
+      - /var/log/[[.Module]]/[[.Fileset]].log*
+    os.darwin:
+      - /usr/local/var/log/[[.Module]]/[[.Fileset]].log*
+    os.windows:
+      - c:/programdata/[[.Module]]/logs/[[.Fileset]].log*
+
+ingest_pipeline: ingest/pipeline.json
+input: config/[[.Fileset]].yml
+`},
+	{Path: "config/[[.Fileset]].yml", Content: `type: log
+paths:
+{{ range $i, $path := .paths }}
+ - {{$path}}
+{{ end }}
+exclude_files: [".gz$"]
+`},
+	{Path: "ingest/pipeline.json", Content: `{
+  "description": "Pipeline for parsing [[.Module]] [[.Fileset]] logs",
+  "processors": [
+  ],
+  "on_failure": [{
+    "set": {
+      "field": "error.message",
+      "value": "{{ _ingest.on_failure_message }}"
+    }
+  }]
+}
+`},
+	{Path: "_meta/fields.yml", Content: `- name: [[.Fileset]]
+  type: group
+  description: >
+    [[.Fileset]] fileset
+  fields:
+    - name: message
+      type: text
+      description: >
+        The log message.
+`},
+	{Path: "test/[[.Fileset]].log", Content: ``},
+}
+
+// newBeatFiles are created for a new Beat by bake new-beat.
+var newBeatFiles = []scaffoldFile{
+	{Path: "main.go", Content: `package main
+
+import (
+	"os"
+
+	"[[.ImportPath]]/cmd"
+
+	_ "[[.ImportPath]]/include"
+)
+
+func main() {
+	if err := cmd.RootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+`},
+	{Path: "cmd/root.go", Content: `package cmd
+
+import (
+	cmd "github.com/elastic/beats/libbeat/cmd"
+
+	"[[.ImportPath]]/beater"
+)
+
+// Name of this beat.
+var Name = "[[.Beat]]"
+
+// RootCmd to handle beats cli.
+var RootCmd = cmd.GenRootCmd(Name, "", beater.New)
+`},
+	{Path: "beater/[[.Beat]].go", Content: `package beater
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+
+	"[[.ImportPath]]/config"
+)
+
+// [[title .Beat]] publishes an event every period.
+type [[title .Beat]] struct {
+	done   chan struct{}
+	config config.Config
+	client beat.Client
+}
+
+// New creates an instance of [[.Beat]].
+func New(b *beat.Beat, cfg *common.Config) (beat.Beater, error) {
+	c := config.DefaultConfig
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+
+	bt := &[[title .Beat]]{
+		done:   make(chan struct{}),
+		config: c,
+	}
+	return bt, nil
+}
+
+// Run publishes events until Stop is called.
+func (bt *[[title .Beat]]) Run(b *beat.Beat) error {
+	logp.Info("[[.Beat]] is running! Hit CTRL-C to stop it.")
+
+	var err error
+	bt.client, err = b.Publisher.Connect()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(bt.config.Period)
+	defer ticker.Stop()
+	counter := 1
+	for {
+		select {
+		case <-bt.done:
+			return nil
+		case <-ticker.C:
+		}
+
+		event := beat.Event{
+			Timestamp: time.Now(),
+			Fields: common.MapStr{
+				"type":    b.Info.Name,
+				"counter": counter,
+			},
+		}
+		bt.client.Publish(event)
+		logp.Info("Event sent")
+		counter++
+	}
+}
+
+// Stop stops the Beat.
+func (bt *[[title .Beat]]) Stop() {
+	bt.client.Close()
+	close(bt.done)
+}
+`},
+	{Path: "config/config.go", Content: `// Package config contains the configuration of [[.Beat]]. It is a separate
+// package to prevent cyclic imports when it is needed in several locations.
+package config
+
+import "time"
+
+// Config is the configuration of [[.Beat]].
+type Config struct {
+	Period time.Duration ` + "`config:\"period\"`" + `
+}
+
+// DefaultConfig is the default configuration.
+var DefaultConfig = Config{
+	Period: 1 * time.Second,
+}
+`},
+	{Path: "_meta/beat.yml", Content: `################### [[title .Beat]] Configuration Example #########################
+
+############################# [[title .Beat]] ######################################
+
+[[.Beat]]:
+  # Defines how often an event is sent to the output
+  period: 1s
+
+# Modules created by bake generate are appended to this list.
+[[.Beat]].modules:
+`},
+	{Path: "_meta/beat.reference.yml", Content: `################### [[title .Beat]] Configuration Example #########################
+
+############################# [[title .Beat]] ######################################
+
+[[.Beat]]:
+  # Defines how often an event is sent to the output
+  period: 1s
+
+# Modules created by bake generate are appended to this list.
+[[.Beat]].modules:
+`},
+	{Path: "_meta/fields.yml", Content: `- key: [[.Beat]]
+  title: [[.Beat]]
+  description: >
+    Fields exported by [[.Beat]].
+  fields:
+    - name: counter
+      type: long
+      required: true
+      description: >
+        Number of events sent since the Beat started.
+`},
+	{Path: "docker-compose.yml", Content: `version: '2.1'
+services:
+  elasticsearch:
+    image: docker.elastic.co/elasticsearch/elasticsearch:6.0.0
+    environment:
+      - "ES_JAVA_OPTS=-Xms512m -Xmx512m"
+      - "xpack.security.enabled=false"
+    ports:
+      - 9200
+`},
+	{Path: ".bake.yml", Content: `beat:
+  name: [[yaml .Beat]]
+
+imports:
+  local: [[yaml .ImportPath]]
+
+notice:
+  beat: [[yaml (title .Beat)]]
+  copyright: [[yaml .Copyright]]
+  year: [[.Year]]
+`},
+	{Path: ".gitignore", Content: `/build
+/data
+/logs
+/[[.Beat]]
+/[[.Beat]].test
+`},
+	{Path: "README.md", Content: `# [[title .Beat]]
+
+[[title .Beat]] is a Beat that publishes a counter every period.
+
+## Getting Started
+
+Start the test services and open a shell with their addresses in the
+environment:
+
+    bake docker
+
+Build and run [[.Beat]]:
+
+    go build
+    ./[[.Beat]] -c [[.Beat]].yml -e -d "*"
+
+After changing a fields.yml or a config snippet in _meta, regenerate the
+derived files:
+
+    bake update
+`},
+}
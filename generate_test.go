@@ -0,0 +1,224 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRenderScaffoldMetricset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bake-generate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	header, err := newLicenseHeader(testHeaderTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatter := &sourceFormatter{header: header}
+	params := scaffoldParams{Module: "redis", Metricset: "info", Metricsets: []string{"info"}}
+
+	moduleDir := filepath.Join(dir, "module", "redis")
+	if _, err := renderScaffold(moduleDir, append(metricsModuleFiles, metricsModuleFieldsFiles...), params, formatter); err != nil {
+		t.Fatal(err)
+	}
+	created, err := renderScaffold(filepath.Join(moduleDir, "info"), metricsetFiles, params, formatter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, created, filepath.Join(moduleDir, "info", "info.go"))
+
+	src, err := ioutil.ReadFile(filepath.Join(moduleDir, "info", "info.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, header.hasHeader(src))
+	assert.Contains(t, string(src), `mb.Registry.AddMetricSet("redis", "info", New)`)
+
+	config, err := ioutil.ReadFile(filepath.Join(moduleDir, "_meta", "config.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(config), `metricsets: ["info"]`)
+
+	// The generated fields combine into a valid module.
+	sections, findings := loadTestFields(t, dir)
+	assert.Empty(t, findings)
+	assert.Empty(t, validateFields("fields", sections))
+
+	// Existing files are not overwritten.
+	_, err = renderScaffold(filepath.Join(moduleDir, "info"), metricsetFiles, params, formatter)
+	assert.Error(t, err)
+}
+
+func TestRenderScaffoldFileset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bake-generate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	params := scaffoldParams{Module: "nginx", Fileset: "access", Filesets: []string{"access"}}
+	moduleDir := filepath.Join(dir, "module", "nginx")
+	if _, err := renderScaffold(moduleDir, append(logsModuleFiles, logsModuleFieldsFiles...), params, &sourceFormatter{}); err != nil {
+		t.Fatal(err)
+	}
+	created, err := renderScaffold(filepath.Join(moduleDir, "access"), filesetFiles, params, &sourceFormatter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range append(created, filepath.Join(moduleDir, "_meta", "config.yml")) {
+		if filepath.Ext(f) != ".yml" {
+			continue
+		}
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "{{") {
+			// Filebeat input templates are rendered by Filebeat.
+			assert.Contains(t, string(data), "{{ range $i, $path := .paths }}")
+			continue
+		}
+		var v interface{}
+		assert.NoError(t, yaml.Unmarshal(data, &v), f)
+	}
+
+	sections, findings := loadTestFields(t, dir)
+	assert.Empty(t, findings)
+	assert.Empty(t, validateFields("fields", sections))
+}
+
+func TestRenderScaffoldNewBeat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bake-generate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := &NewBeatCommand{Name: "countbeat", Org: "acme"}
+	params := cmd.params()
+	assert.Equal(t, "github.com/acme/countbeat", params.ImportPath)
+	assert.Equal(t, "acme", params.Copyright)
+
+	formatter := &sourceFormatter{localImports: []string{params.ImportPath}}
+	if _, err := renderScaffold(dir, newBeatFiles, params, formatter); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := ioutil.ReadFile(filepath.Join(dir, "beater", "countbeat.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(src), "type Countbeat struct")
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, projectConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ProjectConfig{}
+	if assert.NoError(t, yaml.Unmarshal(data, config)) {
+		assert.Equal(t, "countbeat", config.Beat.Name)
+		assert.Equal(t, "Countbeat", config.Notice.Beat)
+		assert.Equal(t, params.Year, config.Notice.Year)
+	}
+
+	sections, findings := loadTestFields(t, dir)
+	assert.Empty(t, findings)
+	assert.Empty(t, validateFields("fields", sections))
+}
+
+func TestRenderScaffoldNewBeatConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bake-generate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	params := (&NewBeatCommand{Name: "countbeat", Org: "acme", Copyright: "Acme: Labs"}).params()
+	if _, err := renderScaffold(dir, newBeatFiles, params, &sourceFormatter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadProjectConfig(filepath.Join(dir, projectConfigFile))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Acme: Labs", config.Notice.Copyright)
+		assert.Equal(t, "github.com/acme/countbeat", config.Imports.Local)
+	}
+}
+
+// TestGenerateUpdateCheck generates modules into a new Beat and verifies that
+// bake update succeeds and that the result passes the fields and update
+// checks.
+func TestGenerateUpdateCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bake-generate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	params := (&NewBeatCommand{Name: "countbeat", Org: "acme"}).params()
+	formatter := &sourceFormatter{localImports: []string{params.ImportPath}}
+	if _, err := renderScaffold(dir, newBeatFiles, params, formatter); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadProjectConfig(filepath.Join(dir, projectConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Files.IncludeGitIgnored = true
+	defer useTestProject(t, dir, config)()
+
+	for _, args := range [][]string{
+		{"generate", "module", "othermod"},
+		{"generate", "metricset", "mymod", "myset"},
+		{"generate", "metricset", "othermod", "otherset"},
+		{"generate", "fileset", "logmod", "access"},
+		{"update"},
+	} {
+		app := kingpin.New("bake", "")
+		registerGenerateCommand(app)
+		registerUpdateCommand(app)
+		if _, err := app.Parse(args); err != nil {
+			t.Fatalf("bake %v: %v", strings.Join(args, " "), err)
+		}
+	}
+
+	for _, check := range []Check{fieldsCheck{}, updateCheck{}} {
+		findings, err := check.Run(CheckOptions{})
+		if assert.NoError(t, err, check.Name()) {
+			assert.Empty(t, findings, check.Name())
+		}
+	}
+
+	// Stale field docs are reported by the fields check only.
+	if err := ioutil.WriteFile(filepath.Join(dir, "docs/fields.asciidoc"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	findings, err := fieldsCheck{}.Run(CheckOptions{})
+	if assert.NoError(t, err) && assert.Len(t, findings, 1) {
+		assert.Contains(t, findings[0].Message, "field documentation is out of date")
+	}
+	findings, err = updateCheck{}.Run(CheckOptions{})
+	if assert.NoError(t, err) {
+		assert.Empty(t, findings)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "countbeat.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var beatConfig map[string]interface{}
+	if assert.NoError(t, yaml.Unmarshal(data, &beatConfig)) {
+		assert.Len(t, beatConfig["countbeat.modules"], 3)
+	}
+}
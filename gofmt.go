@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// gofmtSource formats Go source in the same way as "gofmt -s".
+func gofmtSource(filename string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	ast.SortImports(fset, f)
+	simplify(fset, f)
+
+	buf := new(bytes.Buffer)
+	if err := format.Node(buf, fset, f); err != nil {
+		return nil, errors.Wrapf(err, "failed to format %v", filename)
+	}
+	return buf.Bytes(), nil
+}
+
+// formattedFile is a file whose formatted source differs from the original.
+type formattedFile struct {
+	File      string
+	Original  []byte
+	Formatted []byte
+}
+
+// formatFiles applies format to each file using a pool of workers (one per
+// CPU) and returns the files whose content would change, in the same order as
+// files. Files are not modified.
+func formatFiles(files []string, format func(filename string, src []byte) ([]byte, error)) ([]formattedFile, error) {
+	type result struct {
+		formattedFile
+		err error
+	}
+
+	results := make([]result, len(files))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				src, err := ioutil.ReadFile(files[i])
+				if err != nil {
+					results[i].err = err
+					continue
+				}
+
+				out, err := format(files[i], src)
+				results[i] = result{
+					formattedFile: formattedFile{File: files[i], Original: src, Formatted: out},
+					err:           err,
+				}
+			}
+		}()
+	}
+	for i := range files {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	var changed []formattedFile
+	for _, r := range results {
+		if r.err != nil {
+			return nil, r.err
+		}
+		if !bytes.Equal(r.Original, r.Formatted) {
+			changed = append(changed, r.formattedFile)
+		}
+	}
+	return changed, nil
+}
+
+// writeDiff writes a unified diff of the changes to a file.
+func writeDiff(w io.Writer, f formattedFile) error {
+	return difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(f.Original)),
+		B:        difflib.SplitLines(string(f.Formatted)),
+		FromFile: "a/" + projectRelativePath(f.File),
+		ToFile:   "b/" + projectRelativePath(f.File),
+		Context:  3,
+	})
+}
+
+// Simplification (gofmt -s)
+
+// simplify applies the same simplifications as "gofmt -s":
+//
+//	[]T{T{}, T{}}        =>  []T{{}, {}}
+//	[]*T{&T{}, &T{}}     =>  []*T{{}, {}}
+//	s[a:len(s)]          =>  s[a:]
+//	for x, _ = range v   =>  for x = range v
+//	for _ = range v      =>  for range v
+//
+// It also removes empty declaration groups such as "const ()".
+func simplify(fset *token.FileSet, f *ast.File) {
+	removeEmptyDeclGroups(f)
+	ast.Walk(simplifier{fset}, f)
+}
+
+type simplifier struct {
+	fset *token.FileSet
+}
+
+func (s simplifier) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.CompositeLit:
+		var keyType, eltType ast.Expr
+		switch typ := n.Type.(type) {
+		case *ast.ArrayType:
+			eltType = typ.Elt
+		case *ast.MapType:
+			keyType = typ.Key
+			eltType = typ.Value
+		}
+
+		if eltType != nil {
+			for i, x := range n.Elts {
+				px := &n.Elts[i]
+				if kv, ok := x.(*ast.KeyValueExpr); ok {
+					if keyType != nil {
+						s.simplifyLiteral(keyType, kv.Key, &kv.Key)
+					}
+					x = kv.Value
+					px = &kv.Value
+				}
+				s.simplifyLiteral(eltType, x, px)
+			}
+			// The elements have already been walked.
+			return nil
+		}
+
+	case *ast.SliceExpr:
+		// s[a:len(s)] => s[a:]
+		if n.Max != nil {
+			break
+		}
+		if x, _ := n.X.(*ast.Ident); x != nil && x.Obj != nil {
+			if call, _ := n.High.(*ast.CallExpr); call != nil && len(call.Args) == 1 && !call.Ellipsis.IsValid() {
+				if fun, _ := call.Fun.(*ast.Ident); fun != nil && fun.Name == "len" && fun.Obj == nil {
+					if arg, _ := call.Args[0].(*ast.Ident); arg != nil && arg.Obj == x.Obj {
+						n.High = nil
+					}
+				}
+			}
+		}
+
+	case *ast.RangeStmt:
+		// for x, _ = range v => for x = range v
+		// for _ = range v    => for range v
+		if isBlank(n.Value) {
+			n.Value = nil
+		}
+		if isBlank(n.Key) && n.Value == nil {
+			n.Key = nil
+		}
+	}
+
+	return s
+}
+
+// simplifyLiteral removes the type of the composite literal x when it matches
+// the element type of the enclosing literal.
+func (s simplifier) simplifyLiteral(eltType, x ast.Expr, px *ast.Expr) {
+	ast.Walk(s, x)
+
+	if inner, ok := x.(*ast.CompositeLit); ok && inner.Type != nil {
+		if s.equal(eltType, inner.Type) {
+			inner.Type = nil
+		}
+	}
+
+	// &T{} may be simplified to {} when the element type is *T.
+	if ptr, ok := eltType.(*ast.StarExpr); ok {
+		if addr, ok := x.(*ast.UnaryExpr); ok && addr.Op == token.AND {
+			if inner, ok := addr.X.(*ast.CompositeLit); ok && inner.Type != nil {
+				if s.equal(ptr.X, inner.Type) {
+					inner.Type = nil
+					*px = inner
+				}
+			}
+		}
+	}
+}
+
+// equal returns true if two expressions have the same source representation.
+func (s simplifier) equal(a, b ast.Expr) bool {
+	var bufA, bufB bytes.Buffer
+	if err := printer.Fprint(&bufA, s.fset, a); err != nil {
+		return false
+	}
+	if err := printer.Fprint(&bufB, s.fset, b); err != nil {
+		return false
+	}
+	return bytes.Equal(bufA.Bytes(), bufB.Bytes())
+}
+
+func isBlank(x ast.Expr) bool {
+	ident, ok := x.(*ast.Ident)
+	return ok && ident.Name == "_"
+}
+
+// removeEmptyDeclGroups removes declarations like "const ()" that have no
+// specs and contain no comments.
+func removeEmptyDeclGroups(f *ast.File) {
+	i := 0
+	for _, d := range f.Decls {
+		if g, ok := d.(*ast.GenDecl); !ok || !isEmptyDeclGroup(f, g) {
+			f.Decls[i] = d
+			i++
+		}
+	}
+	f.Decls = f.Decls[:i]
+}
+
+func isEmptyDeclGroup(f *ast.File, g *ast.GenDecl) bool {
+	if g.Doc != nil || g.Specs != nil || !g.Lparen.IsValid() {
+		return false
+	}
+	for _, cg := range f.Comments {
+		if g.Lparen < cg.Pos() && cg.End() <= g.Rparen {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGofmtSourceSimplify(t *testing.T) {
+	src := `package main
+
+import (
+	"os"
+	"fmt"
+)
+
+const ()
+
+type T struct{ A int }
+
+var (
+	ts  = []T{T{1}, T{2}}
+	pts = []*T{&T{1}}
+	m   = map[T]T{T{1}: T{2}}
+)
+
+func main() {
+	s := os.Args
+	s = s[1:len(s)]
+	for i, _ := range s {
+		fmt.Println(i)
+	}
+	for _ = range s {
+	}
+}
+`
+
+	expected := `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type T struct{ A int }
+
+var (
+	ts  = []T{{1}, {2}}
+	pts = []*T{{1}}
+	m   = map[T]T{{1}: {2}}
+)
+
+func main() {
+	s := os.Args
+	s = s[1:]
+	for i := range s {
+		fmt.Println(i)
+	}
+	for range s {
+	}
+}
+`
+
+	out, err := gofmtSource("main.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expected, string(out))
+}
+
+func TestGofmtSourceSyntaxError(t *testing.T) {
+	_, err := gofmtSource("main.go", []byte("package main\n\nfunc {"))
+	assert.Error(t, err)
+}
+
+func TestFormatFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bake-fmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	good := filepath.Join(dir, "good.go")
+	bad := filepath.Join(dir, "bad.go")
+	ioutil.WriteFile(good, []byte("package main\n"), 0644)
+	ioutil.WriteFile(bad, []byte("package main\nvar x = []int{ 1 }\n"), 0644)
+
+	changed, err := formatFiles([]string{good, bad}, gofmtSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, changed, 1) {
+		assert.Equal(t, bad, changed[0].File)
+
+		buf := new(bytes.Buffer)
+		assert.NoError(t, writeDiff(buf, changed[0]))
+		assert.Contains(t, buf.String(), "-var x = []int{ 1 }\n")
+		assert.Contains(t, buf.String(), "+var x = []int{1}\n")
+	}
+
+	// The files are not modified.
+	src, _ := ioutil.ReadFile(bad)
+	assert.Equal(t, "package main\nvar x = []int{ 1 }\n", string(src))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/andrewkroh/bake/common"
+	"github.com/pkg/errors"
+)
+
+// yearPlaceholder is substituted for {{.Year}} when building the regular
+// expression that matches a header.
+const yearPlaceholder = "\x00YEAR\x00"
+
+// buildConstraintRegex matches the build constraint lines at the top of a Go
+// file along with the blank lines that follow them.
+var buildConstraintRegex = regexp.MustCompile(`^(?://go:build [^\n]*\n|// \+build [^\n]*\n)+\s*`)
+
+// headerParams are the parameters available to a header template.
+type headerParams struct {
+	Year string
+}
+
+// licenseHeader checks and inserts a license header described by a template.
+type licenseHeader struct {
+	tmpl  *template.Template
+	regex *regexp.Regexp
+}
+
+// newLicenseHeader parses a header template. The template is the literal text
+// of the header comment and may reference {{.Year}}. When checking a file any
+// year or year range (e.g. 2014-2017) is accepted in place of {{.Year}}.
+func newLicenseHeader(text string) (*licenseHeader, error) {
+	text = strings.TrimRight(text, "\n") + "\n"
+
+	tmpl, err := template.New("header").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid header template")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, headerParams{Year: yearPlaceholder}); err != nil {
+		return nil, errors.Wrap(err, "invalid header template")
+	}
+	pattern := strings.Replace(regexp.QuoteMeta(buf.String()), yearPlaceholder, `\d{4}(?:-\d{4})?`, -1)
+
+	return &licenseHeader{
+		tmpl:  tmpl,
+		regex: regexp.MustCompile("^" + pattern),
+	}, nil
+}
+
+// render returns the header text for the given year.
+func (h *licenseHeader) render(year int) []byte {
+	buf := new(bytes.Buffer)
+	h.tmpl.Execute(buf, headerParams{Year: strconv.Itoa(year)})
+	return buf.Bytes()
+}
+
+// hasHeader returns true if the source begins with the header, either at the
+// top of the file or immediately after the build constraints.
+func (h *licenseHeader) hasHeader(src []byte) bool {
+	src = bytes.Replace(src, []byte("\r\n"), []byte("\n"), -1)
+	if h.regex.Match(src) {
+		return true
+	}
+	if loc := buildConstraintRegex.FindIndex(src); loc != nil {
+		return h.regex.Match(src[loc[1]:])
+	}
+	return false
+}
+
+// insert returns the source with the header added after any build
+// constraints.
+func (h *licenseHeader) insert(src []byte, year int) []byte {
+	var constraints []byte
+	if loc := buildConstraintRegex.FindIndex(src); loc != nil {
+		// Copy the constraints so that appending does not overwrite src.
+		constraints = append(append([]byte(nil), bytes.TrimRight(src[:loc[1]], "\n")...), '\n', '\n')
+		src = src[loc[1]:]
+	}
+
+	out := make([]byte, 0, len(constraints)+len(src)+512)
+	out = append(out, constraints...)
+	out = append(out, h.render(year)...)
+	out = append(out, '\n')
+	return append(out, src...)
+}
+
+// missingHeaders returns the non-generated files that do not have the header.
+func missingHeaders(h *licenseHeader, files []string) ([]string, error) {
+	var missing []string
+	for _, f := range files {
+		src, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		if !common.IsGenerated(src) && !h.hasHeader(src) {
+			missing = append(missing, f)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testHeaderTemplate = `// Copyright {{.Year}} Elasticsearch BV
+//
+// Licensed under the Apache License, Version 2.0.
+`
+
+func TestLicenseHeaderHasHeader(t *testing.T) {
+	h, err := newLicenseHeader(testHeaderTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, h.hasHeader([]byte("// Copyright 2017 Elasticsearch BV\n//\n// Licensed under the Apache License, Version 2.0.\n\npackage main\n")))
+	assert.True(t, h.hasHeader([]byte("// Copyright 2014-2017 Elasticsearch BV\r\n//\r\n// Licensed under the Apache License, Version 2.0.\r\n\r\npackage main\r\n")))
+	assert.True(t, h.hasHeader([]byte("// +build linux\n\n// Copyright 2017 Elasticsearch BV\n//\n// Licensed under the Apache License, Version 2.0.\n\npackage main\n")))
+
+	assert.False(t, h.hasHeader([]byte("package main\n")))
+	assert.False(t, h.hasHeader([]byte("// Copyright XXXX Elasticsearch BV\n//\n// Licensed under the Apache License, Version 2.0.\n\npackage main\n")))
+}
+
+func TestLicenseHeaderInsert(t *testing.T) {
+	h, err := newLicenseHeader(testHeaderTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := h.insert([]byte("package main\n"), 2017)
+	assert.Equal(t, "// Copyright 2017 Elasticsearch BV\n//\n// Licensed under the Apache License, Version 2.0.\n\npackage main\n", string(out))
+	assert.True(t, h.hasHeader(out))
+
+	out = h.insert([]byte("//go:build linux\n// +build linux\n\npackage main\n"), 2017)
+	assert.Equal(t, "//go:build linux\n// +build linux\n\n"+
+		"// Copyright 2017 Elasticsearch BV\n//\n// Licensed under the Apache License, Version 2.0.\n\npackage main\n", string(out))
+	assert.True(t, h.hasHeader(out))
+	// A constraint without a blank line before the package clause.
+	out = h.insert([]byte("//go:build linux\npackage main\n"), 2017)
+	assert.Equal(t, "//go:build linux\n\n"+
+		"// Copyright 2017 Elasticsearch BV\n//\n// Licensed under the Apache License, Version 2.0.\n\npackage main\n", string(out))
+	assert.True(t, h.hasHeader(out))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/andrewkroh/bake/common"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// hookMarker identifies hooks that were installed by bake.
+const hookMarker = "# Installed by bake (github.com/andrewkroh/bake)."
+
+var hooksLog = logrus.WithField("package", "main").WithField("cmd", "hooks")
+
+// gitHooks contains the hook scripts by hook name. The bake binary can be
+// overridden by setting $BAKE.
+var gitHooks = map[string]string{
+	"pre-commit": `#!/bin/sh
+` + hookMarker + `
+# Formats the staged Go files with bake fmt.
+
+files=$(git diff --cached --name-only --diff-filter=ACMR -- '*.go')
+[ -z "$files" ] && exit 0
+
+changed=$(${BAKE:-bake} fmt $files) || exit 1
+if [ -n "$changed" ]; then
+	echo "bake fmt reformatted the following files. Review and stage the changes:" >&2
+	echo "$changed" >&2
+	exit 1
+fi
+`,
+	"pre-push": `#!/bin/sh
+` + hookMarker + `
+# Runs bake check before pushing.
+
+exec ${BAKE:-bake} check
+`,
+}
+
+func registerHooksCommand(app *kingpin.Application) {
+	cmd := &HooksCommand{}
+	hooks := app.Command("hooks", "Manage the git hooks that run bake fmt (pre-commit) and bake check (pre-push).")
+
+	install := hooks.Command("install", "Install the git hooks.").Action(cmd.Install)
+	install.Flag("force", "Overwrite existing hooks that were not installed by bake").BoolVar(&cmd.Force)
+
+	uninstall := hooks.Command("uninstall", "Remove the git hooks installed by bake.").Action(cmd.Uninstall)
+	uninstall.Flag("force", "Remove existing hooks even if they were not installed by bake").BoolVar(&cmd.Force)
+}
+
+type HooksCommand struct {
+	Force bool
+}
+
+func (c *HooksCommand) Install(ctx *kingpin.ParseContext) error {
+	dir, err := common.GitHooksDir(ProjectRootAbs)
+	if err != nil {
+		return err
+	}
+	return installHooks(dir, c.Force)
+}
+
+func (c *HooksCommand) Uninstall(ctx *kingpin.ParseContext) error {
+	dir, err := common.GitHooksDir(ProjectRootAbs)
+	if err != nil {
+		return err
+	}
+	return uninstallHooks(dir, c.Force)
+}
+
+func hookNames() []string {
+	names := make([]string, 0, len(gitHooks))
+	for name := range gitHooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isBakeHook returns true if the hook file exists and was installed by bake.
+func isBakeHook(path string) (exists bool, ours bool, err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, false, nil
+		}
+		return false, false, errors.Wrap(err, "failed to read existing hook")
+	}
+	return true, bytes.Contains(content, []byte(hookMarker)), nil
+}
+
+// installHooks writes the hooks into dir. Hooks that exist and were not
+// installed by bake are only overwritten when force is true.
+func installHooks(dir string, force bool) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "failed to create hooks directory")
+	}
+
+	// Check all hooks before writing any so that nothing is modified when
+	// there is a conflict.
+	for _, name := range hookNames() {
+		path := filepath.Join(dir, name)
+		exists, ours, err := isBakeHook(path)
+		if err != nil {
+			return err
+		}
+		if exists && !ours && !force {
+			return errors.Errorf("hook %v already exists and was not installed by bake (use --force to overwrite it)", path)
+		}
+	}
+
+	for _, name := range hookNames() {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(gitHooks[name]), 0755); err != nil {
+			return errors.Wrapf(err, "failed to write hook %v", path)
+		}
+		// WriteFile does not change the mode of an existing file.
+		if err := os.Chmod(path, 0755); err != nil {
+			return errors.Wrapf(err, "failed to make hook %v executable", path)
+		}
+
+		hooksLog.WithField("hook", path).Info("Installed hook")
+		fmt.Println("installed", path)
+	}
+	return nil
+}
+
+// uninstallHooks removes the hooks installed by bake from dir. Hooks that
+// were not installed by bake are only removed when force is true.
+func uninstallHooks(dir string, force bool) error {
+	for _, name := range hookNames() {
+		path := filepath.Join(dir, name)
+		exists, ours, err := isBakeHook(path)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if !ours && !force {
+			fmt.Fprintf(os.Stderr, "skipping %v because it was not installed by bake (use --force to remove it)\n", path)
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			return errors.Wrapf(err, "failed to remove hook %v", path)
+		}
+		fmt.Println("removed", path)
+	}
+	return nil
+}
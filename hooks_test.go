@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstallHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bake-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A foreign hook blocks installation unless forced.
+	foreign := filepath.Join(dir, "pre-push")
+	if err := ioutil.WriteFile(foreign, []byte("#!/bin/sh\nmake test\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, installHooks(dir, false))
+	_, err = os.Stat(filepath.Join(dir, "pre-commit"))
+	assert.True(t, os.IsNotExist(err), "no hooks are written when there is a conflict")
+
+	// Foreign hooks are not removed unless forced.
+	assert.NoError(t, uninstallHooks(dir, false))
+	_, err = os.Stat(foreign)
+	assert.NoError(t, err)
+
+	if err := installHooks(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range hookNames() {
+		exists, ours, err := isBakeHook(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.True(t, exists && ours, name)
+	}
+
+	// Reinstalling over our own hooks does not require force.
+	assert.NoError(t, installHooks(dir, false))
+
+	assert.NoError(t, uninstallHooks(dir, false))
+	for _, name := range hookNames() {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+}
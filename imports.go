@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Import groups in the order they appear in an import block.
+const (
+	importGroupStd = iota
+	importGroupThirdParty
+	importGroupLocal
+)
+
+// importGroup returns the group of an import path. Paths whose first element
+// does not contain a dot are considered to be part of the standard library.
+func importGroup(path string, localPrefixes []string) int {
+	for _, prefix := range localPrefixes {
+		if prefix != "" && (path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")) {
+			return importGroupLocal
+		}
+	}
+
+	first := path
+	if i := strings.Index(path, "/"); i != -1 {
+		first = path[:i]
+	}
+	if !strings.Contains(first, ".") {
+		return importGroupStd
+	}
+	return importGroupThirdParty
+}
+
+type importSpec struct {
+	group int
+	path  string
+	name  string
+	text  []byte // Source of the spec including its comments.
+}
+
+// fixImports sorts the imports of each parenthesized import declaration and
+// separates them into groups for the standard library, third-party packages,
+// and packages matching localPrefixes. When no local prefixes are given the
+// existing groups of non-standard library imports are kept (e.g. a separate
+// group for the project's own packages). The result is gofmt formatted. It
+// returns the line of the first import declaration that changed (or 0 if
+// none changed). Declarations containing comments that are not attached to an
+// import, or importing "C", are left unchanged.
+func fixImports(filename string, src []byte, localPrefixes []string) ([]byte, int, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments|parser.ImportsOnly)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tokFile := fset.File(f.Pos())
+	offset := func(p token.Pos) int { return tokFile.Offset(p) }
+
+	type edit struct {
+		start, end int
+		text       []byte
+		line       int
+	}
+	var edits []edit
+
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT || !gen.Lparen.IsValid() || len(gen.Specs) == 0 {
+			continue
+		}
+
+		specs, ok := collectImportSpecs(fset, f, gen, src, offset, localPrefixes)
+		if !ok {
+			continue
+		}
+
+		sort.SliceStable(specs, func(i, j int) bool {
+			if specs[i].group != specs[j].group {
+				return specs[i].group < specs[j].group
+			}
+			if specs[i].path != specs[j].path {
+				return specs[i].path < specs[j].path
+			}
+			return specs[i].name < specs[j].name
+		})
+
+		buf := new(bytes.Buffer)
+		buf.WriteString("(\n")
+		for i, spec := range specs {
+			if i > 0 && spec.group != specs[i-1].group {
+				buf.WriteString("\n")
+			}
+			buf.WriteString("\t")
+			buf.Write(spec.text)
+			buf.WriteString("\n")
+		}
+		buf.WriteString(")")
+
+		edits = append(edits, edit{
+			start: offset(gen.Lparen),
+			end:   offset(gen.Rparen) + 1,
+			text:  buf.Bytes(),
+			line:  fset.Position(gen.Pos()).Line,
+		})
+	}
+
+	// Report the first declaration whose text differs.
+	line := 0
+	for _, e := range edits {
+		if !bytes.Equal(src[e.start:e.end], e.text) {
+			line = e.line
+			break
+		}
+	}
+	if line == 0 {
+		return src, 0, nil
+	}
+
+	out := append([]byte(nil), src...)
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		out = append(out[:e.start], append(e.text, out[e.end:]...)...)
+	}
+
+	out, err = format.Source(out)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to format %v", filename)
+	}
+	return out, line, nil
+}
+
+// collectImportSpecs returns the specs of an import declaration along with
+// their source text. It returns false if the declaration cannot be safely
+// rewritten.
+func collectImportSpecs(fset *token.FileSet, f *ast.File, gen *ast.GenDecl, src []byte, offset func(token.Pos) int, localPrefixes []string) ([]importSpec, bool) {
+	attached := map[*ast.CommentGroup]bool{}
+	var specs []importSpec
+	var block, prevEnd int // Blank line separated block of the spec.
+	for _, s := range gen.Specs {
+		spec := s.(*ast.ImportSpec)
+
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || path == "C" {
+			return nil, false
+		}
+
+		start, end := spec.Pos(), spec.End()
+		if spec.Doc != nil {
+			start = spec.Doc.Pos()
+			attached[spec.Doc] = true
+		}
+		if spec.Comment != nil {
+			end = spec.Comment.End()
+			attached[spec.Comment] = true
+		}
+
+		var name string
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+
+		startLine, endLine := fset.Position(start).Line, fset.Position(end).Line
+		if prevEnd > 0 && startLine > prevEnd+1 {
+			block++
+		}
+		prevEnd = endLine
+
+		group := importGroup(path, localPrefixes)
+		if group != importGroupStd && len(localPrefixes) == 0 {
+			group = importGroupThirdParty + block
+		}
+
+		specs = append(specs, importSpec{
+			group: group,
+			path:  path,
+			name:  name,
+			text:  src[offset(start):offset(end)],
+		})
+	}
+
+	// Free-floating comments inside the block cannot be placed reliably.
+	for _, cg := range f.Comments {
+		if cg.Pos() > gen.Lparen && cg.End() < gen.Rparen && !attached[cg] {
+			return nil, false
+		}
+	}
+
+	return specs, true
+}
+
+// checkImports returns the line of the first import declaration in file that
+// is not grouped and sorted (or 0 if the imports are correct).
+func checkImports(file string, localPrefixes []string) (int, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	_, line, err := fixImports(file, src, localPrefixes)
+	return line, err
+}
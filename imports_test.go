@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var beatsLocal = []string{"github.com/elastic/beats"}
+
+func TestImportGroup(t *testing.T) {
+	assert.Equal(t, importGroupStd, importGroup("fmt", beatsLocal))
+	assert.Equal(t, importGroupStd, importGroup("net/http", beatsLocal))
+	assert.Equal(t, importGroupThirdParty, importGroup("github.com/pkg/errors", beatsLocal))
+	assert.Equal(t, importGroupThirdParty, importGroup("github.com/elastic/beats-tester", beatsLocal))
+	assert.Equal(t, importGroupLocal, importGroup("github.com/elastic/beats/libbeat/common", beatsLocal))
+	assert.Equal(t, importGroupLocal, importGroup("github.com/elastic/beats", beatsLocal))
+}
+
+func TestFixImports(t *testing.T) {
+	src := `package main
+
+import (
+	"github.com/elastic/beats/libbeat/common"
+	"os"
+	// Doc comment stays with errors.
+	"github.com/pkg/errors"
+
+	"fmt" // fmt comment
+	logp "github.com/elastic/beats/libbeat/logp"
+)
+
+func main() {}
+`
+
+	expected := `package main
+
+import (
+	"fmt" // fmt comment
+	"os"
+
+	// Doc comment stays with errors.
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/libbeat/common"
+	logp "github.com/elastic/beats/libbeat/logp"
+)
+
+func main() {}
+`
+
+	out, line, err := fixImports("main.go", []byte(src), beatsLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, line)
+	assert.Equal(t, expected, string(out))
+
+	// Fixing is idempotent.
+	out, line, err = fixImports("main.go", out, beatsLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, line)
+	assert.Equal(t, expected, string(out))
+}
+
+func TestFixImportsWithoutLocalPrefixes(t *testing.T) {
+	// Existing groups of non-standard library imports are kept.
+	for _, src := range []string{
+		"package main\n\nimport (\n\t\"os\"\n\n\t\"github.com/pkg/errors\"\n\n\t\"github.com/elastic/beats/libbeat/common\"\n)\n",
+		"package main\n\nimport (\n\t\"os\"\n\n\t\"github.com/elastic/beats/libbeat/common\"\n\t\"github.com/pkg/errors\"\n)\n",
+	} {
+		out, line, err := fixImports("main.go", []byte(src), nil)
+		if assert.NoError(t, err) {
+			assert.Equal(t, 0, line)
+			assert.Equal(t, src, string(out))
+		}
+	}
+
+	// Each group is sorted and standard library imports are moved first.
+	src := "package main\n\nimport (\n\t\"github.com/pkg/errors\"\n\t\"os\"\n\n\t\"github.com/elastic/beats/libbeat/logp\"\n\t\"github.com/elastic/beats/libbeat/common\"\n)\n"
+	expected := "package main\n\nimport (\n\t\"os\"\n\n\t\"github.com/pkg/errors\"\n\n\t\"github.com/elastic/beats/libbeat/common\"\n\t\"github.com/elastic/beats/libbeat/logp\"\n)\n"
+	out, line, err := fixImports("main.go", []byte(src), nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, line)
+		assert.Equal(t, expected, string(out))
+	}
+}
+
+func TestFixImportsSkipped(t *testing.T) {
+	for _, src := range []string{
+		// Free-floating comment.
+		"package main\n\nimport (\n\t\"os\"\n\n\t// TODO\n\n\t\"fmt\"\n)\n",
+		// Block importing "C".
+		"package main\n\nimport (\n\t\"os\"\n\t\"C\"\n)\n",
+	} {
+		out, line, err := fixImports("main.go", []byte(src), nil)
+		if assert.NoError(t, err) {
+			assert.Equal(t, 0, line)
+			assert.Equal(t, src, string(out))
+		}
+	}
+}
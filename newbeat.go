@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/andrewkroh/bake/common"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var newBeatLog = logrus.WithField("package", "main").WithField("cmd", "new-beat")
+
+// githubOrgRegex matches valid GitHub user and organization names.
+var githubOrgRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
+func registerNewBeatCommand(app *kingpin.Application) {
+	cmd := &NewBeatCommand{}
+	newBeat := app.Command("new-beat", "Generate a new community Beat and initialize a Git repository for it.").Action(cmd.Run)
+	newBeat.Flag("org", "GitHub user or organization that hosts the Beat (used in the import path github.com/<org>/<name>)").Required().StringVar(&cmd.Org)
+	newBeat.Flag("dir", "Directory to create the Beat in (default: ./<name>)").PlaceHolder("DIR").StringVar(&cmd.Dir)
+	newBeat.Flag("copyright", "Copyright owner used in the NOTICE (default: the org)").StringVar(&cmd.Copyright)
+	newBeat.Arg("name", "Name of the Beat (e.g. countbeat)").Required().StringVar(&cmd.Name)
+}
+
+type NewBeatCommand struct {
+	Name      string
+	Org       string
+	Dir       string
+	Copyright string
+}
+
+func (c *NewBeatCommand) Run(ctx *kingpin.ParseContext) error {
+	if !scaffoldNameRegex.MatchString(c.Name) {
+		return errors.Errorf("invalid beat name %q (use lower case letters, digits, and underscores)", c.Name)
+	}
+	if !githubOrgRegex.MatchString(c.Org) {
+		return errors.Errorf("invalid org %q (use letters, digits, and hyphens)", c.Org)
+	}
+
+	dir := c.Dir
+	if dir == "" {
+		dir = c.Name
+	}
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 {
+		return errors.Errorf("%v already exists and is not empty", dir)
+	}
+
+	params := c.params()
+	formatter := &sourceFormatter{localImports: []string{params.ImportPath}}
+	created, err := renderScaffold(dir, newBeatFiles, params, formatter)
+	for _, f := range created {
+		fmt.Println(f)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := common.RunCommand(exec.Command("git", "init", "-q", dir)); err != nil {
+		return err
+	}
+
+	notice := &NoticeCommand{
+		BeatName:  BeatConfig{Name: c.Name}.BeatTitle(),
+		Copyright: params.Copyright,
+		Year:      params.Year,
+		Output:    filepath.Join(dir, "NOTICE"),
+		Dirs:      []string{dir},
+	}
+	if err := generateNotice(notice); err != nil {
+		return errors.Wrap(err, "failed to generate NOTICE")
+	}
+	fmt.Println(notice.Output)
+
+	return c.update(dir)
+}
+
+// params returns the template parameters for the new Beat.
+func (c *NewBeatCommand) params() scaffoldParams {
+	copyright := c.Copyright
+	if copyright == "" {
+		copyright = c.Org
+	}
+	return scaffoldParams{
+		Beat:       c.Name,
+		ImportPath: "github.com/" + c.Org + "/" + c.Name,
+		Copyright:  copyright,
+		Year:       time.Now().Year(),
+	}
+}
+
+// update runs bake update in the new Beat's directory to generate the
+// combined fields.yml, fields.go, docs, Kibana index pattern, and configs.
+// It runs as a separate process so that the project root and config are
+// those of the new Beat.
+func (c *NewBeatCommand) update(dir string) error {
+	bake, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(bake, "update")
+	cmd.Dir = dir
+	out, err := common.RunCommand(cmd)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate the Beat's derived files")
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		if line := s.Text(); line != "" {
+			fmt.Println(filepath.Join(dir, line))
+		}
+	}
+	newBeatLog.WithField("dir", dir).Info("created new beat")
+	return s.Err()
+}
@@ -6,7 +6,6 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -24,13 +23,16 @@ const (
 var noticeLog = logrus.WithField("package", "main").WithField("cmd", "notice")
 
 func registerNoticeCommand(app *kingpin.Application) {
-	cmd := getNoticeCommandDefaults()
+	// The beat, copyright, and year defaults come from the project config
+	// which is not loaded until the command runs.
+	cmd := &NoticeCommand{}
+	defaults := getNoticeCommandDefaults()
 	notice := app.Command("notice", "Create a NOTICE file containing the licenses of the project's vendored dependencies.").Action(cmd.Run)
-	notice.Flag("beat", "Beat name").Short('b').Default(cmd.BeatName).StringVar(&cmd.BeatName)
-	notice.Flag("copyright", "Copyright owner").Short('c').Default(cmd.Copyright).StringVar(&cmd.Copyright)
-	notice.Flag("year", "Copyright begin year").Short('y').Default(strconv.Itoa(cmd.Year)).IntVar(&cmd.Year)
-	notice.Flag("output", "Output file").Short('o').Default(cmd.Output).PlaceHolder(cmd.Output).StringVar(&cmd.Output)
-	notice.Arg("dirs", "Directories to recursively search for vendored license files. Defaults to the project root.").Default(cmd.Dirs[0]).ExistingDirsVar(&cmd.Dirs)
+	notice.Flag("beat", "Beat name (default: notice.beat from the project config or Elastic Beats)").Short('b').StringVar(&cmd.BeatName)
+	notice.Flag("copyright", "Copyright owner (default: notice.copyright from the project config or Elasticsearch BV)").Short('c').StringVar(&cmd.Copyright)
+	notice.Flag("year", "Copyright begin year (default: notice.year from the project config or 2014)").Short('y').IntVar(&cmd.Year)
+	notice.Flag("output", "Output file").Short('o').Default(defaults.Output).PlaceHolder(defaults.Output).StringVar(&cmd.Output)
+	notice.Arg("dirs", "Directories to recursively search for vendored license files. Defaults to the project root.").Default(defaults.Dirs[0]).ExistingDirsVar(&cmd.Dirs)
 }
 
 type NoticeCommand struct {
@@ -41,17 +43,41 @@ type NoticeCommand struct {
 	Dirs      []string
 }
 
+// getNoticeCommandDefaults returns the default NOTICE options. The beat,
+// copyright, and year can be overridden in the project config.
 func getNoticeCommandDefaults() *NoticeCommand {
-	return &NoticeCommand{
+	cmd := &NoticeCommand{
 		BeatName:  "Elastic Beats",
 		Copyright: "Elasticsearch BV",
 		Year:      2014,
 		Output:    filepath.Join(ProjectRootRel, "NOTICE"),
 		Dirs:      []string{filepath.Join(ProjectRootRel, ".")},
 	}
+
+	if c := projectConfig.Notice; c.Beat != "" {
+		cmd.BeatName = c.Beat
+	}
+	if c := projectConfig.Notice; c.Copyright != "" {
+		cmd.Copyright = c.Copyright
+	}
+	if c := projectConfig.Notice; c.Year != 0 {
+		cmd.Year = c.Year
+	}
+	return cmd
 }
 
 func (c *NoticeCommand) Run(ctx *kingpin.ParseContext) error {
+	defaults := getNoticeCommandDefaults()
+	if c.BeatName == "" {
+		c.BeatName = defaults.BeatName
+	}
+	if c.Copyright == "" {
+		c.Copyright = defaults.Copyright
+	}
+	if c.Year == 0 {
+		c.Year = defaults.Year
+	}
+
 	noticeLog.WithField("output", c.Output).WithField("dirs", c.Dirs).Debug("Running notice")
 	return generateNotice(c)
 }
@@ -62,6 +88,15 @@ func generateNotice(cmd *NoticeCommand) error {
 		return err
 	}
 
+	// Licenses are only searched for in vendor directories, which are often
+	// ignored by git, so only the exclude patterns apply to them.
+	filter := projectConfig.Files.Filter()
+	filter.IncludeGitIgnored = true
+	licenses, err = filter.Filter(licenses)
+	if err != nil {
+		return err
+	}
+
 	noticeLog.WithField("licenses", licenses).Info("Found license files")
 
 	var projects []*projectInfo
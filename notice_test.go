@@ -2,6 +2,9 @@ package main
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -54,3 +57,29 @@ func TestNoticeGetLibraryName(t *testing.T) {
 	name := getLibraryName(path)
 	assert.Equal(t, "github.com/StackExchange/wmi", name)
 }
+
+func TestNoticeGitIgnoredVendor(t *testing.T) {
+	dir := writeFieldsFiles(t, map[string]string{
+		".gitignore":                           "/vendor\n",
+		"vendor/github.com/acme/lib/LICENSE":   "Apache License\n",
+		"vendor/github.com/acme/other/LICENSE": "MIT License\n",
+	})
+	defer os.RemoveAll(dir)
+	if out, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+
+	config := &ProjectConfig{Files: FilesConfig{Exclude: []string{"vendor/github.com/acme/other/**"}}}
+	defer useTestProject(t, dir, config)()
+
+	cmd := &NoticeCommand{BeatName: "Testbeat", Copyright: "Acme", Year: 2017, Output: "NOTICE", Dirs: []string{"."}}
+	if err := generateNotice(cmd); err != nil {
+		t.Fatal(err)
+	}
+	notice, err := ioutil.ReadFile("NOTICE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(notice), "github.com/acme/lib")
+	assert.NotContains(t, string(notice), "github.com/acme/other")
+}
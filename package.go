@@ -0,0 +1,517 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/andrewkroh/bake/common"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var packageLog = logrus.WithField("package", "main").WithField("cmd", "package")
+
+// packageTypes are the package formats in the order that they are built.
+var packageTypes = []string{"targz", "zip", "deb", "rpm"}
+
+// packageVersionRegex matches versions that are valid in all package
+// formats. The part after the first hyphen (e.g. SNAPSHOT) is used as the
+// rpm release.
+var packageVersionRegex = regexp.MustCompile(`^[0-9][A-Za-z0-9.+~]*(-[A-Za-z0-9.+~]+)?$`)
+
+func registerPackageCommand(app *kingpin.Application) {
+	cmd := &PackageCommand{}
+	pkg := app.Command("package", "Package the cross-compiled binaries into tar.gz, zip, deb, and rpm files with SHA-512 checksums.").Action(cmd.Run)
+	pkg.Flag("version", "Version of the packages (default: package.version from the project config or the build version)").StringVar(&cmd.Version)
+	pkg.Flag("platform", "GOOS/GOARCH to package (default: build.platforms from the project config)").PlaceHolder("GOOS/GOARCH").StringsVar(&cmd.Platforms)
+	pkg.Flag("no-cache", "Recreate packages that are in the build cache").BoolVar(&cmd.NoCache)
+	pkg.Flag("type", "Package types to create: "+strings.Join(packageTypes, ", ")+" (default: all types supported by each platform)").EnumsVar(&cmd.Types, packageTypes...)
+}
+
+type PackageCommand struct {
+	Version   string
+	Platforms []string
+	Types     []string
+	NoCache   bool
+}
+
+func (c *PackageCommand) Run(ctx *kingpin.ParseContext) error {
+	version := c.Version
+	if version == "" {
+		version = projectConfig.Package.Version
+	}
+	if version == "" {
+		var err error
+		if version, err = projectVersion(); err != nil {
+			return err
+		}
+	}
+	if version == "" {
+		return errors.New("no package version (use --version, set package.version or build.version_file in the project config, or tag the commit)")
+	}
+	if !packageVersionRegex.MatchString(version) {
+		return errors.Errorf("invalid package version %q", version)
+	}
+
+	platforms, err := parsePlatforms(c.Platforms)
+	if err != nil {
+		return err
+	}
+
+	types := map[string]bool{}
+	for _, t := range c.Types {
+		types[t] = true
+	}
+
+	outputDir := projectConfig.Package.OutputDir()
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+
+	// Setting SOURCE_DATE_EPOCH fixes the time of the packaged files so
+	// that the packages are reproducible.
+	modTime := time.Now().UTC().Truncate(time.Second)
+	fixedTime := os.Getenv("SOURCE_DATE_EPOCH") != ""
+	if fixedTime {
+		if modTime, err = sourceDateEpoch(); err != nil {
+			return err
+		}
+	}
+
+	// Packages depend on the bake version that writes them.
+	bake, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	bakeDigest, err := common.Sha256Sum(bake)
+	if err != nil {
+		return err
+	}
+	cache := newBuildCache(c.NoCache)
+	for _, p := range platforms {
+		spec, err := newPackageSpec(p, version, modTime)
+		if err != nil {
+			return err
+		}
+
+		for _, t := range spec.Types() {
+			if len(types) > 0 && !types[t] {
+				continue
+			}
+			name := spec.packageName(t)
+			path := filepath.Join(outputDir, name)
+			key := spec.cacheKey(t, bakeDigest, fixedTime)
+			cached, err := cache.get(key, name, path)
+			if err != nil {
+				return err
+			}
+			if !cached {
+				if err := spec.write(t, path); err != nil {
+					return err
+				}
+				if err := cache.put(key, path); err != nil {
+					return err
+				}
+			}
+			if err := writeChecksumFile(path); err != nil {
+				return err
+			}
+			fmt.Println(path)
+			fmt.Println(path + ".sha512")
+		}
+	}
+	return nil
+}
+
+// packageFile is a file (or directory) in a package.
+type packageFile struct {
+	Name   string      // Slash separated path within the package.
+	Data   []byte      // Contents of a regular file.
+	Mode   os.FileMode // Permissions and os.ModeDir for directories.
+	Config bool        // Config file that is preserved on upgrade (deb and rpm).
+}
+
+// packageSpec describes the packages of a Beat for one platform.
+type packageSpec struct {
+	Beat     string
+	Version  string
+	Platform platform
+	ModTime  time.Time
+
+	Binary  []byte
+	Configs []packageFile // <beat>.yml, <beat>.reference.yml, and fields.yml.
+	Docs    []packageFile // LICENSE, NOTICE, and README.
+
+	Vendor      string
+	Maintainer  string
+	Homepage    string
+	Description string
+	License     string
+}
+
+// newPackageSpec reads the files that are packaged for the platform. The
+// binary must have been built by bake crosscompile.
+func newPackageSpec(p platform, version string, modTime time.Time) (*packageSpec, error) {
+	cfg := projectConfig.Package
+	spec := &packageSpec{
+		Beat:        projectConfig.Beat.BeatName(),
+		Version:     version,
+		Platform:    p,
+		ModTime:     modTime,
+		Vendor:      cfg.Vendor,
+		Maintainer:  cfg.Maintainer,
+		Homepage:    cfg.Homepage,
+		Description: cfg.Description,
+		License:     cfg.License,
+	}
+	if spec.Vendor == "" {
+		spec.Vendor = getNoticeCommandDefaults().Copyright
+	}
+	if spec.Maintainer == "" {
+		spec.Maintainer = spec.Vendor
+	}
+	if spec.Description == "" {
+		spec.Description = projectConfig.Beat.BeatTitle() + " sends data to Elasticsearch."
+	}
+	if spec.License == "" {
+		spec.License = "ASL 2.0"
+	}
+
+	binary := binaryPath(p)
+	data, err := ioutil.ReadFile(binary)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("%v not found (run bake crosscompile first)", binary)
+		}
+		return nil, err
+	}
+	spec.Binary = data
+
+	for _, reference := range []bool{false, true} {
+		data, err := packageBeatConfig(reference, p.GOOS)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		f := packageFile{Name: filepath.Base(beatConfigPath(reference)), Data: data, Mode: 0644}
+		if !reference {
+			// Beats refuse to load a config that is writable by others.
+			f.Mode = 0600
+			f.Config = true
+		}
+		spec.Configs = append(spec.Configs, f)
+	}
+
+	fields := projectConfig.Fields.CombinedPath()
+	if data, err := ioutil.ReadFile(fields); err == nil {
+		spec.Configs = append(spec.Configs, packageFile{Name: "fields.yml", Data: data, Mode: 0644})
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, name := range []string{"LICENSE", "LICENSE.txt", "NOTICE", "NOTICE.txt", "README.md", "README.asciidoc"} {
+		data, err := ioutil.ReadFile(filepath.Join(ProjectRootRel, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		spec.Docs = append(spec.Docs, packageFile{Name: name, Data: data, Mode: 0644})
+	}
+
+	return spec, nil
+}
+
+// packageBeatConfig returns the Beat's config for the GOOS. It is assembled
+// from the _meta snippets when they exist and otherwise read from the
+// project. It returns nil if the Beat has no such config.
+func packageBeatConfig(reference bool, goos string) ([]byte, error) {
+	snippets, err := beatConfigSnippets(reference)
+	if err != nil {
+		return nil, err
+	}
+	if len(snippets) > 0 {
+		return assembleBeatConfig(reference, goos)
+	}
+
+	data, err := ioutil.ReadFile(beatConfigPath(reference))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Types returns the package types that are supported by the platform.
+func (s *packageSpec) Types() []string {
+	switch {
+	case s.Platform.GOOS == "windows":
+		return []string{"zip"}
+	case s.Platform.GOOS != "linux":
+		return []string{"targz"}
+	}
+
+	types := []string{"targz"}
+	if debArch(s.Platform.GOARCH) != "" {
+		types = append(types, "deb")
+	}
+	if rpmArch(s.Platform.GOARCH) != "" {
+		types = append(types, "rpm")
+	}
+	return types
+}
+
+// packageName returns the file name of the package of the given type.
+func (s *packageSpec) packageName(packageType string) string {
+	switch packageType {
+	case "zip":
+		return s.archiveName() + ".zip"
+	case "deb":
+		return s.Beat + "-" + s.Version + "-" + debArch(s.Platform.GOARCH) + ".deb"
+	case "rpm":
+		return s.Beat + "-" + s.Version + "-" + rpmArch(s.Platform.GOARCH) + ".rpm"
+	default:
+		return s.archiveName() + ".tar.gz"
+	}
+}
+
+// write creates the package of the given type at path.
+func (s *packageSpec) write(packageType, path string) error {
+	var writer func(io.Writer) error
+	switch packageType {
+	case "targz":
+		writer = func(w io.Writer) error { return writeTarGz(w, "", s.archiveFiles(), s.ModTime) }
+	case "zip":
+		writer = func(w io.Writer) error { return writeZip(w, s.archiveFiles(), s.ModTime) }
+	case "deb":
+		writer = s.writeDeb
+	case "rpm":
+		writer = s.writeRPM
+	default:
+		return errors.Errorf("unknown package type %v", packageType)
+	}
+
+	packageLog.WithField("platform", s.Platform).WithField("package", path).Debug("writing package")
+	buf := new(bytes.Buffer)
+	if err := writer(buf); err != nil {
+		return errors.Wrapf(err, "failed to create %v", path)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return errors.Wrapf(err, "failed to write %v", path)
+	}
+	return nil
+}
+
+// cacheKey returns the build cache key of the package of the given type.
+// bake is the digest of the bake executable that writes the package. The
+// time of the files is only part of the key when includeTime is true.
+func (s *packageSpec) cacheKey(packageType, bake string, includeTime bool) string {
+	parts := []string{"package", bake, packageType, s.Beat, s.Version, s.Platform.String(),
+		s.Vendor, s.Maintainer, s.Homepage, s.Description, s.License, dataDigest(s.Binary)}
+	if includeTime {
+		parts = append(parts, s.ModTime.Format(time.RFC3339))
+	}
+	for _, f := range append(append([]packageFile(nil), s.Configs...), s.Docs...) {
+		parts = append(parts, f.Name, f.Mode.String(), strconv.FormatBool(f.Config), dataDigest(f.Data))
+	}
+	return cacheKey(parts...)
+}
+
+func dataDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeChecksumFile writes <file>.sha512 in the format used by sha512sum.
+func writeChecksumFile(file string) error {
+	sum, err := common.Sha512Sum(file)
+	if err != nil {
+		return err
+	}
+	line := sum + "  " + filepath.Base(file) + "\n"
+	return ioutil.WriteFile(file+".sha512", []byte(line), 0644)
+}
+
+// archiveName returns the name of the tar.gz or zip archive without its
+// extension. It is also the name of the directory within the archive.
+func (s *packageSpec) archiveName() string {
+	arch := s.Platform.GOARCH
+	switch arch {
+	case "amd64":
+		arch = "x86_64"
+	case "386":
+		arch = "x86"
+	}
+	return s.Beat + "-" + s.Version + "-" + s.Platform.GOOS + "-" + arch
+}
+
+// archiveFiles returns the contents of the tar.gz or zip archive. All files
+// are in a single top-level directory.
+func (s *packageSpec) archiveFiles() []packageFile {
+	root := s.archiveName()
+	binary := s.Beat
+	if s.Platform.GOOS == "windows" {
+		binary += ".exe"
+	}
+
+	files := []packageFile{
+		{Name: root, Mode: os.ModeDir | 0755},
+		{Name: path.Join(root, binary), Data: s.Binary, Mode: 0755},
+	}
+	for _, f := range append(append([]packageFile(nil), s.Configs...), s.Docs...) {
+		f.Name = path.Join(root, f.Name)
+		f.Config = false
+		files = append(files, f)
+	}
+	return files
+}
+
+// systemFiles returns the contents of the deb and rpm packages. The binary is
+// installed to /usr/share/<beat>/bin and started by a /usr/bin/<beat> script
+// that points the Beat to its config, data, and log directories.
+func (s *packageSpec) systemFiles() []packageFile {
+	home := "/usr/share/" + s.Beat
+	config := "/etc/" + s.Beat
+	script := fmt.Sprintf(`#!/bin/sh
+# Script to run %[1]v in foreground with the same path settings that
+# the init script / systemd unit file would do.
+
+exec %[2]v/bin/%[1]v \
+  --path.home %[2]v \
+  --path.config %[3]v \
+  --path.data /var/lib/%[1]v \
+  --path.logs /var/log/%[1]v \
+  "$@"
+`, s.Beat, home, config)
+
+	files := []packageFile{
+		{Name: config, Mode: os.ModeDir | 0755},
+		{Name: home, Mode: os.ModeDir | 0755},
+		{Name: home + "/bin", Mode: os.ModeDir | 0755},
+		{Name: home + "/bin/" + s.Beat, Data: s.Binary, Mode: 0755},
+		{Name: "/usr/bin/" + s.Beat, Data: []byte(script), Mode: 0755},
+	}
+	for _, f := range s.Configs {
+		f.Name = config + "/" + f.Name
+		files = append(files, f)
+	}
+	for _, f := range s.Docs {
+		f.Name = home + "/" + f.Name
+		files = append(files, f)
+	}
+	return files
+}
+
+// summary returns the first line of the description.
+func (s *packageSpec) summary() string {
+	return strings.SplitN(strings.TrimSpace(s.Description), "\n", 2)[0]
+}
+
+// writeTarGz writes the files to a gzip compressed tar archive. See writeTar.
+func writeTarGz(w io.Writer, prefix string, files []packageFile, modTime time.Time) error {
+	gz, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if err := writeTar(gz, prefix, files, modTime); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeTar writes the files to a tar archive. Parent directories that are not
+// listed are added. Each name has its leading slash removed and is prefixed by
+// prefix. The files are owned by root.
+func writeTar(w io.Writer, prefix string, files []packageFile, modTime time.Time) error {
+	tw := tar.NewWriter(w)
+	for _, f := range withParentDirs(files) {
+		header := &tar.Header{
+			Name:     prefix + strings.TrimPrefix(f.Name, "/"),
+			Mode:     int64(f.Mode.Perm()),
+			ModTime:  modTime,
+			Uname:    "root",
+			Gname:    "root",
+			Typeflag: tar.TypeReg,
+			Size:     int64(len(f.Data)),
+		}
+		if f.Mode.IsDir() {
+			header.Name += "/"
+			header.Typeflag = tar.TypeDir
+			header.Size = 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// withParentDirs returns the files preceded by any of their parent
+// directories that are not listed. The order of the files is preserved.
+func withParentDirs(files []packageFile) []packageFile {
+	seen := map[string]bool{}
+	for _, f := range files {
+		seen[strings.TrimSuffix(f.Name, "/")] = true
+	}
+
+	var out []packageFile
+	for _, f := range files {
+		var parents []string
+		for dir := path.Dir(f.Name); dir != "." && dir != "/" && !seen[dir]; dir = path.Dir(dir) {
+			seen[dir] = true
+			parents = append(parents, dir)
+		}
+		sort.Strings(parents)
+		for _, dir := range parents {
+			out = append(out, packageFile{Name: dir, Mode: os.ModeDir | 0755})
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// writeZip writes the files to a zip archive.
+func writeZip(w io.Writer, files []packageFile, modTime time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		header := &zip.FileHeader{
+			Name:     f.Name,
+			Method:   zip.Deflate,
+			Modified: modTime,
+		}
+		header.SetMode(f.Mode)
+		if f.Mode.IsDir() {
+			header.Name += "/"
+			header.Method = zip.Store
+		}
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
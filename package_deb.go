@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// debArch returns the Debian architecture of the GOARCH or an empty string
+// if debs are not built for it.
+func debArch(goarch string) string {
+	switch goarch {
+	case "amd64", "arm64":
+		return goarch
+	case "386":
+		return "i386"
+	case "arm":
+		return "armhf"
+	}
+	return ""
+}
+
+// writeDeb writes a Debian binary package. A deb is an ar archive containing
+// the debian-binary version file, control.tar.gz, and data.tar.gz.
+func (s *packageSpec) writeDeb(w io.Writer) error {
+	files := s.systemFiles()
+
+	data := new(bytes.Buffer)
+	if err := writeTarGz(data, "./", files, s.ModTime); err != nil {
+		return err
+	}
+
+	control := new(bytes.Buffer)
+	if err := writeTarGz(control, "./", s.debControlFiles(files), s.ModTime); err != nil {
+		return err
+	}
+
+	ar := &arWriter{w: w, modTime: s.ModTime}
+	ar.writeHeader()
+	ar.writeFile("debian-binary", []byte("2.0\n"))
+	ar.writeFile("control.tar.gz", control.Bytes())
+	ar.writeFile("data.tar.gz", data.Bytes())
+	return ar.err
+}
+
+// debControlFiles returns the control, md5sums, and conffiles files of the
+// deb.
+func (s *packageSpec) debControlFiles(files []packageFile) []packageFile {
+	var size int
+	md5sums := new(bytes.Buffer)
+	conffiles := new(bytes.Buffer)
+	for _, f := range files {
+		if f.Mode.IsDir() {
+			continue
+		}
+		size += len(f.Data)
+		fmt.Fprintf(md5sums, "%x  %v\n", md5.Sum(f.Data), strings.TrimPrefix(f.Name, "/"))
+		if f.Config {
+			fmt.Fprintln(conffiles, f.Name)
+		}
+	}
+
+	control := new(bytes.Buffer)
+	fmt.Fprintf(control, "Package: %v\n", s.Beat)
+	fmt.Fprintf(control, "Version: %v\n", s.Version)
+	fmt.Fprintf(control, "Architecture: %v\n", debArch(s.Platform.GOARCH))
+	fmt.Fprintf(control, "Maintainer: %v\n", s.Maintainer)
+	fmt.Fprintf(control, "Vendor: %v\n", s.Vendor)
+	fmt.Fprintf(control, "Installed-Size: %d\n", (size+1023)/1024)
+	fmt.Fprintf(control, "Section: default\n")
+	fmt.Fprintf(control, "Priority: optional\n")
+	if s.Homepage != "" {
+		fmt.Fprintf(control, "Homepage: %v\n", s.Homepage)
+	}
+	fmt.Fprintf(control, "Description: %v\n", s.summary())
+	lines := strings.Split(strings.TrimSpace(s.Description), "\n")
+	for _, line := range lines[1:] {
+		// Extended description lines start with a space and blank lines
+		// are represented by a dot.
+		if line = strings.TrimSpace(line); line == "" {
+			line = "."
+		}
+		fmt.Fprintf(control, " %v\n", line)
+	}
+
+	out := []packageFile{
+		{Name: "control", Data: control.Bytes(), Mode: 0644},
+		{Name: "md5sums", Data: md5sums.Bytes(), Mode: 0644},
+	}
+	if conffiles.Len() > 0 {
+		out = append(out, packageFile{Name: "conffiles", Data: conffiles.Bytes(), Mode: 0644})
+	}
+	return out
+}
+
+// arWriter writes the common ar archive format used by debs. The first error
+// is recorded and subsequent writes are skipped.
+type arWriter struct {
+	w       io.Writer
+	modTime time.Time
+	err     error
+}
+
+func (a *arWriter) write(data []byte) {
+	if a.err == nil {
+		_, a.err = a.w.Write(data)
+	}
+}
+
+func (a *arWriter) writeHeader() {
+	a.write([]byte("!<arch>\n"))
+}
+
+func (a *arWriter) writeFile(name string, data []byte) {
+	header := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, a.modTime.Unix(), 0, 0, 0100644, len(data))
+	a.write([]byte(header))
+	a.write(data)
+	// File data is aligned to an even offset.
+	if len(data)%2 != 0 {
+		a.write([]byte("\n"))
+	}
+}
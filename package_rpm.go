@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// rpmArch returns the rpm architecture of the GOARCH or an empty string if
+// rpms are not built for it.
+func rpmArch(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i686"
+	case "arm64":
+		return "aarch64"
+	}
+	return ""
+}
+
+// rpm header data types.
+const (
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeBinary      = 7
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// rpm header tags. See rpmtag.h in the rpm sources.
+const (
+	rpmTagHeaderSignatures  = 62
+	rpmTagHeaderImmutable   = 63
+	rpmTagHeaderI18NTable   = 100
+	rpmTagName              = 1000
+	rpmTagVersion           = 1001
+	rpmTagRelease           = 1002
+	rpmTagSummary           = 1004
+	rpmTagDescription       = 1005
+	rpmTagBuildTime         = 1006
+	rpmTagSize              = 1009
+	rpmTagVendor            = 1011
+	rpmTagLicense           = 1014
+	rpmTagPackager          = 1015
+	rpmTagGroup             = 1016
+	rpmTagURL               = 1020
+	rpmTagOS                = 1021
+	rpmTagArch              = 1022
+	rpmTagFileSizes         = 1028
+	rpmTagFileModes         = 1030
+	rpmTagFileRdevs         = 1033
+	rpmTagFileMtimes        = 1034
+	rpmTagFileDigests       = 1035
+	rpmTagFileLinktos       = 1036
+	rpmTagFileFlags         = 1037
+	rpmTagFileUsername      = 1039
+	rpmTagFileGroupname     = 1040
+	rpmTagSourceRPM         = 1044
+	rpmTagFileVerifyFlags   = 1045
+	rpmTagProvideName       = 1047
+	rpmTagRequireFlags      = 1048
+	rpmTagRequireName       = 1049
+	rpmTagRequireVersion    = 1050
+	rpmTagFileDevices       = 1095
+	rpmTagFileInodes        = 1096
+	rpmTagFileLangs         = 1097
+	rpmTagProvideFlags      = 1112
+	rpmTagProvideVersion    = 1113
+	rpmTagDirIndexes        = 1116
+	rpmTagBasenames         = 1117
+	rpmTagDirnames          = 1118
+	rpmTagPayloadFormat     = 1124
+	rpmTagPayloadCompressor = 1125
+	rpmTagPayloadFlags      = 1126
+	rpmTagFileDigestAlgo    = 5011
+
+	rpmSigTagSHA1        = 269
+	rpmSigTagSHA256      = 273
+	rpmSigTagSize        = 1000
+	rpmSigTagMD5         = 1004
+	rpmSigTagPayloadSize = 1007
+)
+
+const (
+	rpmFileConfig    = 1 << 0
+	rpmFileNoReplace = 1 << 4
+
+	rpmSenseEqual  = 1 << 3
+	rpmSenseLess   = 1 << 1
+	rpmSenseRPMLib = 1 << 24
+
+	rpmDigestSHA256 = 8
+)
+
+// rpmVersion splits the package version into the rpm version and release
+// because rpm versions cannot contain hyphens (e.g. 6.0.0-SNAPSHOT becomes
+// version 6.0.0 and release SNAPSHOT).
+func rpmVersion(version string) (string, string) {
+	parts := strings.SplitN(version, "-", 2)
+	if len(parts) == 1 {
+		return version, "1"
+	}
+	return parts[0], parts[1]
+}
+
+// writeRPM writes an rpm binary package. An rpm consists of a lead, a
+// signature header containing digests of the header and payload, a header
+// describing the package and its files, and a gzip compressed cpio payload.
+func (s *packageSpec) writeRPM(w io.Writer) error {
+	// rpm expects the files to be sorted by path.
+	files := s.systemFiles()
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	version, release := rpmVersion(s.Version)
+	arch := rpmArch(s.Platform.GOARCH)
+
+	// Payload.
+	cpio := new(bytes.Buffer)
+	if err := writeCpio(cpio, files, s.ModTime.Unix()); err != nil {
+		return err
+	}
+	payload := new(bytes.Buffer)
+	gz, err := gzip.NewWriterLevel(payload, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := gz.Write(cpio.Bytes()); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	// Header.
+	h := &rpmHeader{}
+	h.addStrings(rpmTagHeaderI18NTable, rpmTypeStringArray, "C")
+	h.addString(rpmTagName, s.Beat)
+	h.addString(rpmTagVersion, version)
+	h.addString(rpmTagRelease, release)
+	h.addStrings(rpmTagSummary, rpmTypeI18NString, s.summary())
+	h.addStrings(rpmTagDescription, rpmTypeI18NString, strings.TrimSpace(s.Description))
+	h.addInt32(rpmTagBuildTime, int32(s.ModTime.Unix()))
+	h.addString(rpmTagVendor, s.Vendor)
+	h.addString(rpmTagLicense, s.License)
+	h.addString(rpmTagPackager, s.Maintainer)
+	h.addStrings(rpmTagGroup, rpmTypeI18NString, "default")
+	if s.Homepage != "" {
+		h.addString(rpmTagURL, s.Homepage)
+	}
+	h.addString(rpmTagOS, "linux")
+	h.addString(rpmTagArch, arch)
+	h.addString(rpmTagSourceRPM, fmt.Sprintf("%v-%v-%v.src.rpm", s.Beat, version, release))
+	h.addStrings(rpmTagProvideName, rpmTypeStringArray, s.Beat, s.Beat+"("+arch+")")
+	h.addInt32(rpmTagProvideFlags, rpmSenseEqual, rpmSenseEqual)
+	h.addStrings(rpmTagProvideVersion, rpmTypeStringArray, version+"-"+release, version+"-"+release)
+	rpmLib := int32(rpmSenseRPMLib | rpmSenseLess | rpmSenseEqual)
+	h.addStrings(rpmTagRequireName, rpmTypeStringArray, "rpmlib(CompressedFileNames)", "rpmlib(FileDigests)", "rpmlib(PayloadFilesHavePrefix)")
+	h.addInt32(rpmTagRequireFlags, rpmLib, rpmLib, rpmLib)
+	h.addStrings(rpmTagRequireVersion, rpmTypeStringArray, "3.0.4-1", "4.6.0-1", "4.0-1")
+	h.addString(rpmTagPayloadFormat, "cpio")
+	h.addString(rpmTagPayloadCompressor, "gzip")
+	h.addString(rpmTagPayloadFlags, "9")
+	h.addInt32(rpmTagFileDigestAlgo, rpmDigestSHA256)
+	s.addRPMFileTags(h, files)
+	header := h.bytes(rpmTagHeaderImmutable)
+
+	// Signature.
+	headerSHA1 := sha1.Sum(header)
+	headerSHA256 := sha256.Sum256(header)
+	md5sum := md5.New()
+	md5sum.Write(header)
+	md5sum.Write(payload.Bytes())
+	sig := &rpmHeader{}
+	sig.addString(rpmSigTagSHA1, hex.EncodeToString(headerSHA1[:]))
+	sig.addString(rpmSigTagSHA256, hex.EncodeToString(headerSHA256[:]))
+	sig.addInt32(rpmSigTagSize, int32(len(header)+payload.Len()))
+	sig.addBinary(rpmSigTagMD5, md5sum.Sum(nil))
+	sig.addInt32(rpmSigTagPayloadSize, int32(cpio.Len()))
+	signature := sig.bytes(rpmTagHeaderSignatures)
+	// The header following the signature is aligned to 8 bytes.
+	if pad := len(signature) % 8; pad != 0 {
+		signature = append(signature, make([]byte, 8-pad)...)
+	}
+
+	for _, data := range [][]byte{rpmLead(s.Beat + "-" + version + "-" + release), signature, header, payload.Bytes()} {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addRPMFileTags adds the tags describing the files in the payload. The
+// file at index i has inode i+1 in the cpio archive.
+func (s *packageSpec) addRPMFileTags(h *rpmHeader, files []packageFile) {
+	var (
+		size                                  int32
+		sizes, mtimes, flags, verify, devices []int32
+		inodes, dirIndexes                    []int32
+		modes, rdevs                          []uint16
+		digests, links, users, groups, langs  []string
+		basenames, dirnames                   []string
+		dirIndex                              = map[string]int32{}
+	)
+	for i, f := range files {
+		mode := uint16(f.Mode.Perm()) | 0100000
+		digest := ""
+		if f.Mode.IsDir() {
+			mode = uint16(f.Mode.Perm()) | 040000
+		} else {
+			sum := sha256.Sum256(f.Data)
+			digest = hex.EncodeToString(sum[:])
+		}
+		var flag int32
+		if f.Config {
+			flag = rpmFileConfig | rpmFileNoReplace
+		}
+
+		dir := path.Dir(f.Name) + "/"
+		index, found := dirIndex[dir]
+		if !found {
+			index = int32(len(dirnames))
+			dirIndex[dir] = index
+			dirnames = append(dirnames, dir)
+		}
+
+		size += int32(len(f.Data))
+		sizes = append(sizes, int32(len(f.Data)))
+		mtimes = append(mtimes, int32(s.ModTime.Unix()))
+		flags = append(flags, flag)
+		verify = append(verify, -1)
+		devices = append(devices, 1)
+		inodes = append(inodes, int32(i+1))
+		dirIndexes = append(dirIndexes, index)
+		modes = append(modes, mode)
+		rdevs = append(rdevs, 0)
+		digests = append(digests, digest)
+		links = append(links, "")
+		users = append(users, "root")
+		groups = append(groups, "root")
+		langs = append(langs, "")
+		basenames = append(basenames, path.Base(f.Name))
+	}
+
+	h.addInt32(rpmTagSize, size)
+	h.addInt32(rpmTagFileSizes, sizes...)
+	h.addInt16(rpmTagFileModes, modes...)
+	h.addInt16(rpmTagFileRdevs, rdevs...)
+	h.addInt32(rpmTagFileMtimes, mtimes...)
+	h.addStrings(rpmTagFileDigests, rpmTypeStringArray, digests...)
+	h.addStrings(rpmTagFileLinktos, rpmTypeStringArray, links...)
+	h.addInt32(rpmTagFileFlags, flags...)
+	h.addStrings(rpmTagFileUsername, rpmTypeStringArray, users...)
+	h.addStrings(rpmTagFileGroupname, rpmTypeStringArray, groups...)
+	h.addInt32(rpmTagFileVerifyFlags, verify...)
+	h.addInt32(rpmTagFileDevices, devices...)
+	h.addInt32(rpmTagFileInodes, inodes...)
+	h.addStrings(rpmTagFileLangs, rpmTypeStringArray, langs...)
+	h.addInt32(rpmTagDirIndexes, dirIndexes...)
+	h.addStrings(rpmTagBasenames, rpmTypeStringArray, basenames...)
+	h.addStrings(rpmTagDirnames, rpmTypeStringArray, dirnames...)
+}
+
+// rpmLead returns the 96 byte lead that begins every rpm. It is obsolete but
+// still required.
+func rpmLead(name string) []byte {
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb, 3, 0}) // Magic and version 3.0.
+	// The type (binary) is 0. The architecture number is ignored by rpm.
+	binary.BigEndian.PutUint16(lead[8:], 1)
+	if len(name) > 65 {
+		name = name[:65]
+	}
+	copy(lead[10:76], name)
+	binary.BigEndian.PutUint16(lead[76:], 1) // OS (Linux).
+	binary.BigEndian.PutUint16(lead[78:], 5) // Signature type (header).
+	return lead
+}
+
+// rpmHeader builds an rpm header structure. The same structure is used for
+// the signature and for the header.
+type rpmHeader struct {
+	entries []rpmHeaderEntry
+}
+
+type rpmHeaderEntry struct {
+	Tag   int32
+	Type  int32
+	Count int32
+	Data  []byte
+}
+
+func (h *rpmHeader) add(tag, typ int32, count int, data []byte) {
+	h.entries = append(h.entries, rpmHeaderEntry{Tag: tag, Type: typ, Count: int32(count), Data: data})
+}
+
+func (h *rpmHeader) addString(tag int32, value string) {
+	h.add(tag, rpmTypeString, 1, append([]byte(value), 0))
+}
+
+func (h *rpmHeader) addStrings(tag, typ int32, values ...string) {
+	buf := new(bytes.Buffer)
+	for _, v := range values {
+		buf.WriteString(v)
+		buf.WriteByte(0)
+	}
+	h.add(tag, typ, len(values), buf.Bytes())
+}
+
+func (h *rpmHeader) addInt16(tag int32, values ...uint16) {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, values)
+	h.add(tag, rpmTypeInt16, len(values), buf.Bytes())
+}
+
+func (h *rpmHeader) addInt32(tag int32, values ...int32) {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, values)
+	h.add(tag, rpmTypeInt32, len(values), buf.Bytes())
+}
+
+func (h *rpmHeader) addBinary(tag int32, value []byte) {
+	h.add(tag, rpmTypeBinary, len(value), value)
+}
+
+// bytes returns the encoded header. The first entry is the region tag that
+// marks all of the entries as immutable.
+func (h *rpmHeader) bytes(regionTag int32) []byte {
+	entries := append([]rpmHeaderEntry(nil), h.entries...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Tag < entries[j].Tag })
+
+	index := new(bytes.Buffer)
+	store := new(bytes.Buffer)
+	writeEntry := func(e rpmHeaderEntry, offset int) {
+		binary.Write(index, binary.BigEndian, []int32{e.Tag, e.Type, int32(offset), e.Count})
+	}
+
+	for _, e := range entries {
+		// Numbers are aligned to their size within the data store.
+		align := map[int32]int{rpmTypeInt16: 2, rpmTypeInt32: 4}[e.Type]
+		for align > 0 && store.Len()%align != 0 {
+			store.WriteByte(0)
+		}
+		writeEntry(e, store.Len())
+		store.Write(e.Data)
+	}
+
+	// The region trailer at the end of the data store is an entry whose
+	// negative offset covers the whole index.
+	trailerOffset := store.Len()
+	binary.Write(store, binary.BigEndian, []int32{regionTag, rpmTypeBinary, -16 * int32(len(entries)+1), 16})
+
+	out := new(bytes.Buffer)
+	out.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+	binary.Write(out, binary.BigEndian, []int32{int32(len(entries) + 1), int32(store.Len())})
+	binary.Write(out, binary.BigEndian, []int32{regionTag, rpmTypeBinary, int32(trailerOffset), 16})
+	out.Write(index.Bytes())
+	out.Write(store.Bytes())
+	return out.Bytes()
+}
+
+// writeCpio writes the files to a cpio archive in the SVR4 (newc) format
+// used by rpm payloads. Names are prefixed with "." and the file at index i
+// has inode i+1.
+func writeCpio(w io.Writer, files []packageFile, mtime int64) error {
+	buf := new(bytes.Buffer)
+	writeEntry := func(ino int, mode uint32, nlink int, name string, data []byte) {
+		fmt.Fprintf(buf, "070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X",
+			ino, mode, 0, 0, nlink, mtime, len(data), 0, 0, 0, 0, len(name)+1, 0)
+		buf.WriteString(name)
+		buf.WriteByte(0)
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+		buf.Write(data)
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+
+	for i, f := range files {
+		if f.Mode.IsDir() {
+			writeEntry(i+1, uint32(f.Mode.Perm())|040000, 2, "."+f.Name, nil)
+			continue
+		}
+		writeEntry(i+1, uint32(f.Mode.Perm())|0100000, 1, "."+f.Name, f.Data)
+	}
+	writeEntry(0, 0, 1, "TRAILER!!!", nil)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPackageSpec(t *testing.T, p platform) *packageSpec {
+	dir := writeFieldsFiles(t, map[string]string{
+		"_meta/beat.yml":                       "testbeat:\n{{- if eq .GOOS \"windows\" }}\n  path: 'C:\\'\n{{- else }}\n  path: /\n{{- end }}\n",
+		"fields.yml":                           "- key: testbeat\n",
+		"LICENSE":                              "license\n",
+		"build/bin/testbeat-linux-amd64":       "linux binary",
+		"build/bin/testbeat-windows-amd64.exe": "windows binary",
+	})
+	defer os.RemoveAll(dir)
+
+	config := &ProjectConfig{
+		Beat:    BeatConfig{Name: "testbeat"},
+		Files:   FilesConfig{IncludeGitIgnored: true},
+		Package: PackageConfig{Vendor: "Acme", Description: "Test Beat.\n\nIt tests."},
+	}
+	defer useTestProject(t, dir, config)()
+
+	spec, err := newPackageSpec(p, "1.0.0-SNAPSHOT", time.Unix(1500000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+func TestNewPackageSpec(t *testing.T) {
+	spec := testPackageSpec(t, platform{"linux", "amd64"})
+	assert.Equal(t, "linux binary", string(spec.Binary))
+	assert.Equal(t, "Acme", spec.Maintainer)
+	assert.Equal(t, []string{"targz", "deb", "rpm"}, spec.Types())
+	if assert.Len(t, spec.Configs, 2) {
+		assert.Equal(t, "testbeat.yml", spec.Configs[0].Name)
+		assert.Contains(t, string(spec.Configs[0].Data), "path: /")
+		assert.True(t, spec.Configs[0].Config)
+		assert.Equal(t, "fields.yml", spec.Configs[1].Name)
+	}
+	if assert.Len(t, spec.Docs, 1) {
+		assert.Equal(t, "LICENSE", spec.Docs[0].Name)
+	}
+
+	// The config is assembled for the platform.
+	spec = testPackageSpec(t, platform{"windows", "amd64"})
+	assert.Equal(t, []string{"zip"}, spec.Types())
+	assert.Contains(t, string(spec.Configs[0].Data), `path: 'C:\'`)
+
+	_, err := newPackageSpec(platform{"darwin", "amd64"}, "1.0.0", time.Now())
+	assert.Error(t, err)
+}
+
+func TestWriteTarGz(t *testing.T) {
+	spec := testPackageSpec(t, platform{"linux", "amd64"})
+	buf := new(bytes.Buffer)
+	if err := writeTarGz(buf, "", spec.archiveFiles(), spec.ModTime); err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modes := map[string]os.FileMode{}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		modes[h.Name] = h.FileInfo().Mode()
+	}
+
+	root := "testbeat-1.0.0-SNAPSHOT-linux-x86_64/"
+	assert.Equal(t, map[string]os.FileMode{
+		root:                  os.ModeDir | 0755,
+		root + "testbeat":     0755,
+		root + "testbeat.yml": 0600,
+		root + "fields.yml":   0644,
+		root + "LICENSE":      0644,
+	}, modes)
+}
+
+func TestWriteZip(t *testing.T) {
+	spec := testPackageSpec(t, platform{"windows", "amd64"})
+	buf := new(bytes.Buffer)
+	if err := writeZip(buf, spec.archiveFiles(), spec.ModTime); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	assert.Contains(t, names, "testbeat-1.0.0-SNAPSHOT-windows-x86_64/testbeat.exe")
+}
+
+func TestWriteDeb(t *testing.T) {
+	spec := testPackageSpec(t, platform{"linux", "amd64"})
+	buf := new(bytes.Buffer)
+	if err := spec.writeDeb(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read the ar archive.
+	data := buf.Bytes()
+	if !assert.True(t, bytes.HasPrefix(data, []byte("!<arch>\n"))) {
+		return
+	}
+	members := map[string][]byte{}
+	var names []string
+	for data = data[8:]; len(data) >= 60; {
+		name := strings.TrimSpace(string(data[:16]))
+		size, err := strconv.Atoi(strings.TrimSpace(string(data[48:58])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		members[name] = data[60 : 60+size]
+		names = append(names, name)
+		data = data[60+size+size%2:]
+	}
+	assert.Equal(t, []string{"debian-binary", "control.tar.gz", "data.tar.gz"}, names)
+	assert.Equal(t, "2.0\n", string(members["debian-binary"]))
+
+	control := readTarGz(t, members["control.tar.gz"])
+	assert.Contains(t, control["./control"], "Package: testbeat\nVersion: 1.0.0-SNAPSHOT\nArchitecture: amd64\n")
+	assert.Contains(t, control["./control"], "Description: Test Beat.\n .\n It tests.\n")
+	assert.Equal(t, "/etc/testbeat/testbeat.yml\n", control["./conffiles"])
+
+	files := readTarGz(t, members["data.tar.gz"])
+	assert.Equal(t, "linux binary", files["./usr/share/testbeat/bin/testbeat"])
+	assert.Contains(t, files["./usr/bin/testbeat"], "--path.config /etc/testbeat")
+	assert.Contains(t, files, "./usr/share/")
+}
+
+func readTarGz(t *testing.T, data []byte) map[string]string {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[h.Name] = string(content)
+	}
+}
+
+func TestWriteRPM(t *testing.T) {
+	spec := testPackageSpec(t, platform{"linux", "amd64"})
+	buf := new(bytes.Buffer)
+	if err := spec.writeRPM(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	if !assert.True(t, bytes.HasPrefix(data, []byte{0xed, 0xab, 0xee, 0xdb})) {
+		return
+	}
+	assert.Equal(t, "testbeat-1.0.0-SNAPSHOT", string(bytes.TrimRight(data[10:76], "\x00")))
+
+	// Skip the signature and read the header.
+	signature := readRPMHeader(t, data[96:])
+	headerStart := 96 + len(signature.raw)
+	headerStart += (8 - headerStart%8) % 8
+	header := readRPMHeader(t, data[headerStart:])
+	assert.Equal(t, "testbeat", header.string(rpmTagName))
+	assert.Equal(t, "1.0.0", header.string(rpmTagVersion))
+	assert.Equal(t, "SNAPSHOT", header.string(rpmTagRelease))
+	assert.Equal(t, "x86_64", header.string(rpmTagArch))
+	assert.Equal(t, int32(rpmTagHeaderImmutable), header.tags[0])
+
+	// The payload is a gzip compressed cpio archive of the files.
+	gz, err := gzip.NewReader(bytes.NewReader(data[headerStart+len(header.raw):]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpio, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, bytes.HasPrefix(cpio, []byte("070701")))
+	assert.Contains(t, string(cpio), "./usr/share/testbeat/bin/testbeat\x00")
+	assert.Contains(t, string(cpio), "TRAILER!!!\x00")
+}
+
+type testRPMHeader struct {
+	raw   []byte
+	tags  []int32
+	store []byte
+	index map[int32][4]int32
+}
+
+func readRPMHeader(t *testing.T, data []byte) *testRPMHeader {
+	if !bytes.HasPrefix(data, []byte{0x8e, 0xad, 0xe8, 0x01}) {
+		t.Fatal("invalid rpm header magic")
+	}
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	size := int(binary.BigEndian.Uint32(data[12:]))
+	h := &testRPMHeader{index: map[int32][4]int32{}}
+	for i := 0; i < count; i++ {
+		var entry [4]int32
+		binary.Read(bytes.NewReader(data[16+16*i:]), binary.BigEndian, &entry)
+		h.tags = append(h.tags, entry[0])
+		h.index[entry[0]] = entry
+	}
+	h.store = data[16+16*count : 16+16*count+size]
+	h.raw = data[:16+16*count+size]
+	return h
+}
+
+func (h *testRPMHeader) string(tag int32) string {
+	entry, found := h.index[tag]
+	if !found {
+		return ""
+	}
+	value := h.store[entry[2]:]
+	return string(value[:bytes.IndexByte(value, 0)])
+}
+
+func TestWithParentDirs(t *testing.T) {
+	files := withParentDirs([]packageFile{
+		{Name: "/etc/beat", Mode: os.ModeDir | 0755},
+		{Name: "/usr/share/beat/bin/beat"},
+		{Name: "/etc/beat/beat.yml"},
+	})
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"/etc", "/etc/beat", "/usr", "/usr/share", "/usr/share/beat", "/usr/share/beat/bin", "/usr/share/beat/bin/beat", "/etc/beat/beat.yml"}, names)
+}
+
+func TestWriteChecksumFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bake-package")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "beat.tar.gz")
+	if err := ioutil.WriteFile(file, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeChecksumFile(file); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := ioutil.ReadFile(file + ".sha512")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "e7c22b994c59d9cf2b48e549b1e24666636045930d3da7c1acb299d1c3b7f931f94aae41edda2c2b207a36e10f8bcb8d45223e54878f5b316e7ce3b6bc019629  beat.tar.gz\n", string(sum))
+}
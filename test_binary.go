@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/andrewkroh/bake/common"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var testBinaryLog = logrus.WithField("package", "main").WithField("cmd", "test-binary")
+
+func registerTestBinaryCommand(app *kingpin.Application) {
+	cmd := &TestBinaryCommand{}
+	testBinary := app.Command("test-binary", "Build the Beat's test binary (go test -c) used by the system tests.").Action(cmd.Run)
+	testBinary.Flag("cover", "Instrument the binary to write a coverage profile for the project's packages").BoolVar(&cmd.Cover)
+	testBinary.Flag("reproducible", "Build reproducibly with -trimpath, no build ID, and the build time from SOURCE_DATE_EPOCH (default: the commit time)").BoolVar(&cmd.Reproducible)
+}
+
+type TestBinaryCommand struct {
+	Cover        bool
+	Reproducible bool
+}
+
+func (c *TestBinaryCommand) Run(ctx *kingpin.ParseContext) error {
+	metadata, err := getBuildMetadata(c.Reproducible)
+	if err != nil {
+		return err
+	}
+	flags := buildFlags(metadata.ldflags(projectConfig.Build.Vars), c.Reproducible)
+
+	path := testBinaryPath()
+	out, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	args := testBinaryArgs(flags, out, c.Cover)
+	testBinaryLog.WithField("args", args).Debug("building")
+	cmd := exec.Command("go", args...)
+	cmd.Dir = ProjectRootAbs
+	if _, err := common.RunCommand(cmd); err != nil {
+		return errors.Wrap(err, "failed to build the test binary")
+	}
+	fmt.Println(path)
+	return nil
+}
+
+// testBinaryPath returns the path of the Beat's test binary relative to the
+// current directory (e.g. metricbeat.test in the project root).
+func testBinaryPath() string {
+	return filepath.Join(ProjectRootRel, projectConfig.Beat.BeatName()+".test")
+}
+
+// testBinaryArgs returns the go arguments that build the test binary of the
+// package in the current directory to out.
+func testBinaryArgs(flags []string, out string, cover bool) []string {
+	args := append([]string{"test", "-c"}, flags...)
+	if cover {
+		args = append(args, "-covermode=atomic", "-coverpkg=./...")
+	}
+	return append(args, "-o", out, ".")
+}
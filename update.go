@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var updateLog = logrus.WithField("package", "main").WithField("cmd", "update")
+
+func registerUpdateCommand(app *kingpin.Application) {
+	cmd := &UpdateCommand{}
+	update := app.Command("update", "Regenerate the files that are derived from other files in the project "+
+		"(combined fields.yml, fields.go, field docs, Elasticsearch template, Kibana index pattern, configs, and NOTICE).").Action(cmd.Run)
+	update.Flag("list", "List the artifacts that are generated for the project").BoolVar(&cmd.List)
+	update.Arg("artifacts", "Artifacts to update. Defaults to all artifacts except those disabled in the project config.").StringsVar(&cmd.Artifacts)
+}
+
+type UpdateCommand struct {
+	Artifacts []string
+	List      bool
+}
+
+func (c *UpdateCommand) Run(ctx *kingpin.ParseContext) error {
+	artifacts, err := projectArtifacts()
+	if err != nil {
+		return err
+	}
+
+	if c.List {
+		for _, a := range artifacts {
+			fmt.Printf("%-18s %v\n", a.Name, a.Path)
+		}
+		return nil
+	}
+
+	artifacts, err = selectArtifacts(artifacts, c.Artifacts, projectConfig.Update.Disabled)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range artifacts {
+		data, upToDate, err := a.check()
+		if err != nil {
+			return err
+		}
+		if upToDate {
+			updateLog.WithField("artifact", a.Name).Debug("artifact is up to date")
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(a.Path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(a.Path, data, 0644); err != nil {
+			return errors.Wrapf(err, "failed to write %v", a.Path)
+		}
+		fmt.Println(a.Path)
+	}
+
+	return nil
+}
+
+// artifact is a file that is generated from other files in the project.
+type artifact struct {
+	Name     string                 // Name used to select the artifact.
+	Path     string                 // Path relative to the current directory.
+	Generate func() ([]byte, error) // Returns the contents of the artifact.
+}
+
+// check generates the artifact and returns its contents and whether the
+// existing file is up to date.
+func (a artifact) check() ([]byte, bool, error) {
+	data, err := a.Generate()
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to generate %v", a.Name)
+	}
+
+	existing, err := ioutil.ReadFile(a.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return data, false, nil
+		}
+		return nil, false, err
+	}
+	return data, bytes.Equal(existing, data), nil
+}
+
+// projectArtifacts returns the artifacts that are generated for the project.
+// The fields artifacts are only generated when the project has fields.yml
+// files, the configs when their _meta sources exist, and the NOTICE when the
+// project already has one.
+func projectArtifacts() ([]artifact, error) {
+	var artifacts []artifact
+
+	fields, findings, err := loadBeatFields("update")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			return nil, errors.Errorf("invalid fields file: %v", f)
+		}
+	}
+
+	if fields != nil {
+		artifacts = append(artifacts, fieldsArtifacts(fields)...)
+	}
+
+	for _, reference := range []bool{false, true} {
+		snippets, err := beatConfigSnippets(reference)
+		if err != nil {
+			return nil, err
+		}
+		if len(snippets) == 0 {
+			continue
+		}
+
+		name := "config"
+		if reference {
+			name = "reference-config"
+		}
+		reference := reference
+		artifacts = append(artifacts, artifact{
+			Name: name,
+			Path: beatConfigPath(reference),
+			Generate: func() ([]byte, error) {
+				return assembleBeatConfig(reference, projectConfig.Config.OS())
+			},
+		})
+	}
+
+	notice := getNoticeCommandDefaults()
+	if _, err := os.Stat(notice.Output); err == nil {
+		artifacts = append(artifacts, artifact{Name: "notice", Path: notice.Output, Generate: generateNoticeData})
+	}
+
+	return sortArtifacts(artifacts), nil
+}
+
+// fieldsArtifacts returns the artifacts that are generated from the fields.
+func fieldsArtifacts(fields *beatFields) []artifact {
+	beat := projectConfig.Beat.BeatName()
+	cfg := projectConfig.Fields
+	combined := func() ([]byte, error) { return combinedFieldsYAML(fields.Sections) }
+	goFile := cfg.GoPath()
+
+	return []artifact{
+		{Name: "fields", Path: cfg.CombinedPath(), Generate: combined},
+		{Name: "fields-go", Path: goFile, Generate: func() ([]byte, error) {
+			data, err := combined()
+			if err != nil {
+				return nil, err
+			}
+			pkg := filepath.Base(filepath.Dir(goFile))
+			if pkg == "." {
+				pkg = "main"
+			}
+			return fieldsGoAsset(beat, pkg, data)
+		}},
+		{Name: "fields-docs", Path: cfg.DocsPath(), Generate: func() ([]byte, error) {
+			return generateFieldsDocs(projectConfig.Beat.BeatTitle(), fields.Sections), nil
+		}},
+		{Name: "template", Path: cfg.TemplatePath(beat), Generate: func() ([]byte, error) {
+			return elasticsearchTemplate(beat, projectConfig.Beat.Index(), fields.Sections)
+		}},
+		{Name: "kibana", Path: cfg.KibanaPath(beat), Generate: func() ([]byte, error) {
+			return kibanaIndexPattern(projectConfig.Beat.Index(), fields.Sections)
+		}},
+	}
+}
+
+// artifactOrder is the order in which artifacts are generated and listed.
+var artifactOrder = []string{"fields", "fields-go", "fields-docs", "template", "kibana", "config", "reference-config", "notice"}
+
+func sortArtifacts(artifacts []artifact) []artifact {
+	var sorted []artifact
+	for _, name := range artifactOrder {
+		for _, a := range artifacts {
+			if a.Name == name {
+				sorted = append(sorted, a)
+			}
+		}
+	}
+	return sorted
+}
+
+// selectArtifacts returns the requested artifacts or, if none are requested,
+// all artifacts that are not disabled.
+func selectArtifacts(artifacts []artifact, requested, disabled []string) ([]artifact, error) {
+	byName := map[string]artifact{}
+	var names []string
+	for _, a := range artifacts {
+		byName[a.Name] = a
+		names = append(names, a.Name)
+	}
+
+	if len(requested) > 0 {
+		var selected []artifact
+		for _, name := range requested {
+			a, found := byName[name]
+			if !found {
+				return nil, errors.Errorf("unknown artifact %v (available: %v)", name, strings.Join(names, ", "))
+			}
+			selected = append(selected, a)
+		}
+		return selected, nil
+	}
+
+	skip := map[string]bool{}
+	for _, name := range disabled {
+		skip[name] = true
+	}
+	var selected []artifact
+	for _, a := range artifacts {
+		if !skip[a.Name] {
+			selected = append(selected, a)
+		}
+	}
+	return selected, nil
+}
+
+// generateNoticeData returns the contents of a newly generated NOTICE file.
+func generateNoticeData() ([]byte, error) {
+	f, err := ioutil.TempFile("", "NOTICE-")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	cmd := getNoticeCommandDefaults()
+	cmd.Output = f.Name()
+	if err := generateNotice(cmd); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(f.Name())
+}
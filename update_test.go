@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectArtifacts(t *testing.T) {
+	artifacts := []artifact{{Name: "fields"}, {Name: "kibana"}, {Name: "notice"}}
+	names := func(artifacts []artifact) []string {
+		var names []string
+		for _, a := range artifacts {
+			names = append(names, a.Name)
+		}
+		return names
+	}
+
+	selected, err := selectArtifacts(artifacts, nil, []string{"kibana"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"fields", "notice"}, names(selected))
+	}
+
+	selected, err = selectArtifacts(artifacts, []string{"kibana"}, []string{"kibana"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"kibana"}, names(selected))
+	}
+
+	_, err = selectArtifacts(artifacts, []string{"docs"}, nil)
+	assert.Error(t, err)
+}
+
+func TestFieldsGoAsset(t *testing.T) {
+	fieldsYML := []byte("- key: test\n")
+	src, err := fieldsGoAsset("testbeat", "include", fieldsYML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(src), "package include\n")
+	assert.Contains(t, string(src), `asset.SetFields("testbeat", "fields.yml", Asset)`)
+
+	m := regexp.MustCompile(`return "(.*)"`).FindSubmatch(src)
+	if assert.NotNil(t, m) {
+		compressed, err := base64.StdEncoding.DecodeString(string(m[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, fieldsYML, data)
+	}
+}
+
+func TestKibanaIndexPattern(t *testing.T) {
+	sections := []*fieldsSection{{Key: "test", Fields: []*field{
+		{Name: "@timestamp", Type: "date"},
+		{Name: "test", Type: "group", Fields: []*field{
+			{Name: "message", Type: "text"},
+			{Name: "bytes", Type: "long", Format: "bytes"},
+			{Name: "alias", Type: "alias", Path: "test.bytes"},
+		}},
+	}}}
+
+	data, err := kibanaIndexPattern("testbeat", sections)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pattern struct {
+		Objects []struct {
+			ID         string `json:"id"`
+			Attributes struct {
+				Title          string `json:"title"`
+				Fields         string `json:"fields"`
+				FieldFormatMap string `json:"fieldFormatMap"`
+			} `json:"attributes"`
+		} `json:"objects"`
+	}
+	if err := json.Unmarshal(data, &pattern); err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, pattern.Objects, 1) {
+		return
+	}
+	obj := pattern.Objects[0]
+	assert.Equal(t, "testbeat-*", obj.ID)
+	assert.Equal(t, "testbeat-*", obj.Attributes.Title)
+	assert.Equal(t, `{"test.bytes":{"id":"bytes"}}`, obj.Attributes.FieldFormatMap)
+
+	var fields []kibanaField
+	if err := json.Unmarshal([]byte(obj.Attributes.Fields), &fields); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, fields, 3) {
+		assert.Equal(t, kibanaField{Name: "@timestamp", Type: "date", Indexed: true, DocValues: true, Searchable: true, Aggregatable: true}, fields[0])
+		assert.Equal(t, kibanaField{Name: "test.message", Type: "string", Indexed: true, Analyzed: true, Searchable: true}, fields[1])
+		assert.Equal(t, "number", fields[2].Type)
+	}
+}
+
+func TestElasticsearchTemplate(t *testing.T) {
+	sections := []*fieldsSection{
+		{Key: "test", Fields: []*field{
+			{Name: "test", Type: "group", Fields: []*field{
+				{Name: "hostname"},
+				{Name: "ratio", Type: "scaled_float", Other: map[string]interface{}{"scaling_factor": 100}},
+				{Name: "alias", Type: "alias", Path: "test.hostname"},
+				{Name: "tags", Type: "array"},
+			}},
+		}},
+		{Key: "other", Fields: []*field{
+			{Name: "test", Type: "group", Fields: []*field{
+				{Name: "message", Type: "text", Other: map[string]interface{}{"norms": false}},
+			}},
+		}},
+	}
+
+	data, err := elasticsearchTemplate("testbeat", "testidx", sections)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var template struct {
+		IndexPatterns []string `json:"index_patterns"`
+		Mappings      struct {
+			Meta       map[string]string      `json:"_meta"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := json.Unmarshal(data, &template); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"testidx-*"}, template.IndexPatterns)
+	assert.Equal(t, map[string]string{"beat": "testbeat"}, template.Mappings.Meta)
+	assert.Equal(t, map[string]interface{}{
+		"test": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"hostname": map[string]interface{}{"type": "keyword", "ignore_above": 1024.0},
+				"ratio":    map[string]interface{}{"type": "scaled_float", "scaling_factor": 100.0},
+				"alias":    map[string]interface{}{"type": "alias", "path": "test.hostname"},
+				"message":  map[string]interface{}{"type": "text", "norms": false},
+			},
+		},
+	}, template.Mappings.Properties)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/andrewkroh/bake/common"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var verifyBuildLog = logrus.WithField("package", "main").WithField("cmd", "verify-build")
+
+func registerVerifyBuildCommand(app *kingpin.Application) {
+	cmd := &VerifyBuildCommand{}
+	verify := app.Command("verify-build", "Rebuild the binaries reproducibly and compare their SHA-256 sums to the existing binaries.").Action(cmd.Run)
+	verify.Flag("platform", "GOOS/GOARCH to verify (default: build.platforms from the project config)").PlaceHolder("GOOS/GOARCH").StringsVar(&cmd.Platforms)
+	verify.Flag("cgo", "Rebuild with CGO enabled in the cross-compiler Docker images (for binaries built with bake crosscompile --cgo)").BoolVar(&cmd.CGO)
+}
+
+type VerifyBuildCommand struct {
+	Platforms []string
+	CGO       bool
+}
+
+func (c *VerifyBuildCommand) Run(ctx *kingpin.ParseContext) error {
+	platforms, err := parsePlatforms(c.Platforms)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := getBuildMetadata(true)
+	if err != nil {
+		return err
+	}
+	if metadata.Dirty {
+		verifyBuildLog.Warn("the working tree has uncommitted changes")
+	}
+	flags := buildFlags(metadata.ldflags(projectConfig.Build.Vars), true)
+
+	dir, err := ioutil.TempDir("", "bake-verify-build")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// The rebuild uses an empty build cache so that nothing is reused from
+	// the original build.
+	cache := filepath.Join(dir, "cache")
+	var cgo *cgoToolchain
+	if c.CGO {
+		if cgo, err = newCGOToolchain(cache); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "BINARY\tSHA-256\tREBUILT SHA-256\tRESULT")
+	var differ int
+	for _, p := range platforms {
+		path := binaryPath(p)
+		if _, err := os.Stat(path); err != nil {
+			return errors.Errorf("%v not found (run bake crosscompile --reproducible first)", path)
+		}
+		sum, err := common.Sha256Sum(path)
+		if err != nil {
+			return err
+		}
+
+		rebuilt := filepath.Join(dir, filepath.Base(path))
+		if cgo != nil {
+			err = cgo.build(p, rebuilt, flags)
+		} else {
+			err = crosscompile(p, rebuilt, flags, "GOCACHE="+cache)
+		}
+		if err != nil {
+			return err
+		}
+		rebuiltSum, err := common.Sha256Sum(rebuilt)
+		if err != nil {
+			return err
+		}
+
+		result := "match"
+		if sum != rebuiltSum {
+			result = "differ"
+			differ++
+		}
+		verifyBuildLog.WithField("binary", path).WithField("result", result).Debug("verified build")
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", path, sum, rebuiltSum, result)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if differ > 0 {
+		return errors.Errorf("%d of %d binaries differ from the rebuild (were they built with "+
+			"bake crosscompile --reproducible from commit %v?)", differ, len(platforms), metadata.Commit)
+	}
+	return nil
+}